@@ -22,37 +22,48 @@ const port = 42069
 
 func main() {
     var handler server.Handler = func(r *request.Request, w *response.Writer) *server.HandlerError {
-        // Serve a demo video at /video
-        if r.RequestLine.RequestTarget == "/video" {
-            data, err := os.ReadFile("assets/vim.mp4")
+        target := r.RequestLine.URL
+        // Serve a demo video at /video, streamed from disk so clients can seek
+        if target.Path == "/video" {
+            f, err := os.Open("assets/vim.mp4")
             if err != nil {
                 return &server.HandlerError{Status: response.StatusInternalServerError, Body: []byte("failed to read video\n")}
             }
-            if err := w.WriteStatusLine(response.StatusOK); err != nil {
-                return &server.HandlerError{Status: response.StatusInternalServerError, Body: []byte("write status error\n")}
-            }
-            hdrs := response.GetDefaultHeaders(len(data))
-            hdrs.Set("Content-Type", "video/mp4")
-            if err := w.WriteHeaders(hdrs); err != nil {
-                return &server.HandlerError{Status: response.StatusInternalServerError, Body: []byte("write headers error\n")}
+            defer f.Close()
+            info, err := f.Stat()
+            if err != nil {
+                return &server.HandlerError{Status: response.StatusInternalServerError, Body: []byte("failed to read video\n")}
             }
-            if _, err := w.WriteBody(data); err != nil {
-                return &server.HandlerError{Status: response.StatusInternalServerError, Body: []byte("write body error\n")}
+            err = server.ServeContent(w, r, server.Content{
+                Type:    "video/mp4",
+                ModTime: info.ModTime(),
+                ETag:    fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size()),
+                Body:    f,
+            })
+            if err != nil && !w.WroteAnything() {
+                return &server.HandlerError{Status: response.StatusInternalServerError, Body: []byte("failed to read video\n")}
             }
             return nil
         }
         // Proxy /httpbin/* to https://httpbin.org/* with chunked transfer
-        if strings.HasPrefix(r.RequestLine.RequestTarget, "/httpbin") {
-            path := strings.TrimPrefix(r.RequestLine.RequestTarget, "/httpbin")
+        if strings.HasPrefix(target.Path, "/httpbin") {
+            // Forward the still-encoded path and query upstream.
+            path := strings.TrimPrefix(target.RawPath, "/httpbin")
             if !strings.HasPrefix(path, "/") {
                 path = "/" + path
             }
             url := "https://httpbin.org" + path
+            if target.RawQuery != "" {
+                url += "?" + target.RawQuery
+            }
             if resp, err := http.Get(url); err == nil {
                 defer resp.Body.Close()
 
-                // Mirror upstream status for realism
-                _ = w.WriteStatusLine(response.StatusCode(resp.StatusCode))
+                // Mirror upstream status and reason phrase for realism
+                _, reason, _ := strings.Cut(resp.Status, " ")
+                if err := w.WriteStatusLineReason(response.StatusCode(resp.StatusCode), reason); err != nil {
+                    return &server.HandlerError{Status: response.StatusBadGateway, Body: []byte("invalid upstream status\n")}
+                }
                 hdrs := headers.NewHeaders()
                 ct := resp.Header.Get("Content-Type")
                 if ct == "" {
@@ -131,31 +142,55 @@ func main() {
             // Non-stream fallback not supported in offline mode
             return &server.HandlerError{Status: response.StatusBadRequest, Body: []byte("unsupported httpbin path\n")}
         }
-        // Prepare HTML bodies
+        // Prepare HTML and plain text bodies
         html400 := []byte("<html>\n  <head>\n    <title>400 Bad Request</title>\n  </head>\n  <body>\n    <h1>Bad Request</h1>\n    <p>Your request honestly kinda sucked.</p>\n  </body>\n</html>\n")
         html500 := []byte("<html>\n  <head>\n    <title>500 Internal Server Error</title>\n  </head>\n  <body>\n    <h1>Internal Server Error</h1>\n    <p>Okay, you know what? This one is on me.</p>\n  </body>\n</html>\n")
         html200 := []byte("<html>\n  <head>\n    <title>200 OK</title>\n  </head>\n  <body>\n    <h1>Success!</h1>\n    <p>Your request was an absolute banger.</p>\n  </body>\n</html>\n")
+        text400 := []byte("Bad Request: Your request honestly kinda sucked.\n")
+        text500 := []byte("Internal Server Error: Okay, you know what? This one is on me.\n")
+        text200 := []byte("Success! Your request was an absolute banger.\n")
 
-        switch r.RequestLine.RequestTarget {
+        // Answer in HTML or plain text, whichever the client prefers.
+        // Error pages fall back to HTML when neither is acceptable.
+        contentType := r.Headers.NegotiateContentType("text/html", "text/plain")
+        pageType := contentType
+        if pageType == "" {
+            pageType = "text/html"
+        }
+        pick := func(html, text []byte) []byte {
+            if pageType == "text/plain" {
+                return text
+            }
+            return html
+        }
+
+        switch target.Path {
         case "/yourproblem":
             hdrs := headers.NewHeaders()
-            hdrs.Set("Content-Type", "text/html")
+            hdrs.Set("Content-Type", pageType)
             hdrs.Set("Connection", "close")
             hdrs.Set("Content-Length", "0") // will be overwritten in writeHandlerError
-            return &server.HandlerError{Status: response.StatusBadRequest, Headers: hdrs, Body: html400}
+            hdrs.Set("Vary", "Accept")
+            return &server.HandlerError{Status: response.StatusBadRequest, Headers: hdrs, Body: pick(html400, text400)}
         case "/myproblem":
             hdrs := headers.NewHeaders()
-            hdrs.Set("Content-Type", "text/html")
+            hdrs.Set("Content-Type", pageType)
             hdrs.Set("Connection", "close")
             hdrs.Set("Content-Length", "0")
-            return &server.HandlerError{Status: response.StatusInternalServerError, Headers: hdrs, Body: html500}
+            hdrs.Set("Vary", "Accept")
+            return &server.HandlerError{Status: response.StatusInternalServerError, Headers: hdrs, Body: pick(html500, text500)}
         default:
-            // Write success directly using the response.Writer
-            _ = w.WriteStatusLine(response.StatusOK)
-            hdrs := response.GetDefaultHeaders(len(html200))
-            hdrs.Set("Content-Type", "text/html")
-            _ = w.WriteHeaders(hdrs)
-            _, _ = w.WriteBody(html200)
+            if contentType == "" {
+                hdrs := headers.NewHeaders()
+                hdrs.Set("Vary", "Accept")
+                return &server.HandlerError{Status: response.StatusNotAcceptable, Headers: hdrs, Body: []byte("available types: text/html, text/plain\n")}
+            }
+            // Write success through the io.Writer view; the status and
+            // Content-Length are added for us.
+            rw := w.ResponseWriter()
+            rw.Header().Set("Content-Type", contentType)
+            rw.Header().Set("Vary", "Accept")
+            _, _ = rw.Write(pick(html200, text200))
             return nil
         }
     }
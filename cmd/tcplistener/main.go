@@ -4,7 +4,6 @@ import (
     "fmt"
     "net"
     "os"
-    "sort"
 
     "github.com/xaitan80/httpfromtcp/internal/request"
 )
@@ -41,15 +40,8 @@ func main() {
             fmt.Printf("- Version: %s\n", r.RequestLine.HttpVersion)
 
             fmt.Println("Headers:")
-            if len(r.Headers) > 0 {
-                keys := make([]string, 0, len(r.Headers))
-                for k := range r.Headers {
-                    keys = append(keys, k)
-                }
-                sort.Strings(keys)
-                for _, k := range keys {
-                    fmt.Printf("- %s: %s\n", k, r.Headers[k])
-                }
+            for _, f := range r.Headers.Fields() {
+                fmt.Printf("- %s: %s\n", f.Name, f.Value)
             }
 
             fmt.Println("Body:")
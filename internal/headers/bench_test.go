@@ -0,0 +1,70 @@
+package headers
+
+import (
+	"testing"
+)
+
+// benchFields is a typical request header section.
+const benchFields = "Host: www.example.com\r\n" +
+	"User-Agent: Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0\r\n" +
+	"Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\n" +
+	"Accept-Language: en-US,en;q=0.5\r\n" +
+	"Accept-Encoding: gzip, deflate, br, zstd\r\n" +
+	"Connection: keep-alive\r\n" +
+	"Cookie: session=8f14e45fceea167a5a36dedd4bea2543; theme=dark\r\n" +
+	"Upgrade-Insecure-Requests: 1\r\n" +
+	"Sec-Fetch-Dest: document\r\n" +
+	"Sec-Fetch-Mode: navigate\r\n" +
+	"Sec-Fetch-Site: none\r\n" +
+	"Priority: u=0, i\r\n" +
+	"\r\n"
+
+func BenchmarkParserParse(b *testing.B) {
+	data := []byte(benchFields)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		h := NewHeaders()
+		p := Parser{Mode: Strict}
+		rest := data
+		for {
+			n, done, err := p.Parse(h, rest)
+			if err != nil {
+				b.Fatal(err)
+			}
+			rest = rest[n:]
+			if done {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkParserParseIncremental offers the parser a growing buffer, as
+// happens when a header section arrives over several reads.
+func BenchmarkParserParseIncremental(b *testing.B) {
+	data := []byte(benchFields)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		h := NewHeaders()
+		p := Parser{Mode: Strict}
+		start, end := 0, 0
+		for {
+			if end < len(data) {
+				end += 16
+				if end > len(data) {
+					end = len(data)
+				}
+			}
+			n, done, err := p.Parse(h, data[start:end])
+			if err != nil {
+				b.Fatal(err)
+			}
+			start += n
+			if done {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package headers
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ErrInvalidCookie is returned when a cookie cannot be serialized safely.
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// SameSite is the value of the SameSite cookie attribute.
+type SameSite int
+
+const (
+    // SameSiteDefault omits the attribute.
+    SameSiteDefault SameSite = iota
+    // SameSiteLax sends the cookie on same-site requests and top-level navigations.
+    SameSiteLax
+    // SameSiteStrict sends the cookie on same-site requests only.
+    SameSiteStrict
+    // SameSiteNone sends the cookie on cross-site requests; it requires Secure.
+    SameSiteNone
+)
+
+// Cookie is an HTTP cookie as sent in a Cookie request field or a
+// Set-Cookie response field (RFC 6265). Only Name and Value are sent by
+// clients; the other fields are Set-Cookie attributes.
+type Cookie struct {
+    Name  string
+    Value string
+
+    Domain string
+    Path   string
+    // Expires is omitted when zero.
+    Expires time.Time
+    // MaxAge is omitted when 0. A negative MaxAge deletes the cookie and is
+    // sent as "Max-Age=0".
+    MaxAge      int
+    Secure      bool
+    HttpOnly    bool
+    SameSite    SameSite
+    Partitioned bool
+}
+
+// ParseCookies parses the value of a Cookie request field, a list of
+// "name=value" pairs separated by ";". Pairs with an invalid name or value
+// are skipped. Values wrapped in double quotes are unquoted.
+func ParseCookies(v string) []*Cookie {
+    var cookies []*Cookie
+    for _, pair := range strings.Split(v, ";") {
+        pair = strings.Trim(pair, " \t")
+        name, value, ok := strings.Cut(pair, "=")
+        if !ok || !ValidFieldName(name) {
+            continue
+        }
+        if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+            value = value[1 : len(value)-1]
+        }
+        if !validCookieValue(value) {
+            continue
+        }
+        cookies = append(cookies, &Cookie{Name: name, Value: value})
+    }
+    return cookies
+}
+
+// Cookies returns the cookies sent in the Cookie fields of h, in order.
+func (h *Headers) Cookies() []*Cookie {
+    var cookies []*Cookie
+    for _, v := range h.Values("Cookie") {
+        cookies = append(cookies, ParseCookies(v)...)
+    }
+    return cookies
+}
+
+// Cookie returns the first cookie named name sent in the Cookie fields of
+// h. Cookie names are case-sensitive.
+func (h *Headers) Cookie(name string) (*Cookie, bool) {
+    for _, c := range h.Cookies() {
+        if c.Name == name {
+            return c, true
+        }
+    }
+    return nil, false
+}
+
+// AddCookie validates c and adds it to h as a Set-Cookie field.
+func (h *Headers) AddCookie(c *Cookie) error {
+    v, err := c.SetCookieValue()
+    if err != nil {
+        return err
+    }
+    h.Add("Set-Cookie", v)
+    return nil
+}
+
+// SetCookieValue serializes c as the value of a Set-Cookie field. It
+// returns ErrInvalidCookie if a name, value or attribute contains bytes
+// that could end the field or inject attributes, or if the attributes
+// contradict each other.
+func (c *Cookie) SetCookieValue() (string, error) {
+    if err := c.validate(); err != nil {
+        return "", err
+    }
+    var b strings.Builder
+    b.WriteString(c.Name)
+    b.WriteByte('=')
+    b.WriteString(c.Value)
+    if c.Domain != "" {
+        b.WriteString("; Domain=")
+        b.WriteString(strings.TrimPrefix(c.Domain, "."))
+    }
+    if c.Path != "" {
+        b.WriteString("; Path=")
+        b.WriteString(c.Path)
+    }
+    if !c.Expires.IsZero() {
+        b.WriteString("; Expires=")
+        b.WriteString(FormatTime(c.Expires))
+    }
+    if c.MaxAge > 0 {
+        b.WriteString("; Max-Age=")
+        b.WriteString(strconv.Itoa(c.MaxAge))
+    } else if c.MaxAge < 0 {
+        b.WriteString("; Max-Age=0")
+    }
+    if c.Secure {
+        b.WriteString("; Secure")
+    }
+    if c.HttpOnly {
+        b.WriteString("; HttpOnly")
+    }
+    switch c.SameSite {
+    case SameSiteLax:
+        b.WriteString("; SameSite=Lax")
+    case SameSiteStrict:
+        b.WriteString("; SameSite=Strict")
+    case SameSiteNone:
+        b.WriteString("; SameSite=None")
+    }
+    if c.Partitioned {
+        b.WriteString("; Partitioned")
+    }
+    return b.String(), nil
+}
+
+// String returns the Set-Cookie serialization of c, or "" if it is invalid.
+func (c *Cookie) String() string {
+    v, _ := c.SetCookieValue()
+    return v
+}
+
+// validate checks the name, value and attributes of c.
+func (c *Cookie) validate() error {
+    if !ValidFieldName(c.Name) {
+        return fmt.Errorf("%w: name %q", ErrInvalidCookie, c.Name)
+    }
+    if !validCookieValue(c.Value) {
+        return fmt.Errorf("%w: value for %q", ErrInvalidCookie, c.Name)
+    }
+    if c.Domain != "" && !validCookieDomain(strings.TrimPrefix(c.Domain, ".")) {
+        return fmt.Errorf("%w: domain %q", ErrInvalidCookie, c.Domain)
+    }
+    for i := 0; i < len(c.Path); i++ {
+        // av-octet: any CHAR except CTLs or ";".
+        if ch := c.Path[i]; ch < 0x20 || ch >= 0x7f || ch == ';' {
+            return fmt.Errorf("%w: path %q", ErrInvalidCookie, c.Path)
+        }
+    }
+    if !c.Expires.IsZero() && c.Expires.UTC().Year() < 1601 {
+        return fmt.Errorf("%w: expires before 1601", ErrInvalidCookie)
+    }
+    if c.SameSite < SameSiteDefault || c.SameSite > SameSiteNone {
+        return fmt.Errorf("%w: unknown SameSite value %d", ErrInvalidCookie, int(c.SameSite))
+    }
+    // User agents reject these combinations without Secure.
+    if c.SameSite == SameSiteNone && !c.Secure {
+        return fmt.Errorf("%w: SameSite=None requires Secure", ErrInvalidCookie)
+    }
+    if c.Partitioned && !c.Secure {
+        return fmt.Errorf("%w: Partitioned requires Secure", ErrInvalidCookie)
+    }
+    return nil
+}
+
+// validCookieValue reports whether v consists of cookie-octets:
+// visible ASCII except DQUOTE, comma, semicolon and backslash.
+func validCookieValue(v string) bool {
+    for i := 0; i < len(v); i++ {
+        c := v[i]
+        if c <= 0x20 || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+            return false
+        }
+    }
+    return true
+}
+
+// validCookieDomain reports whether d is a host name made of letters,
+// digits, '-' and '.' labels.
+func validCookieDomain(d string) bool {
+    if d == "" || len(d) > 255 {
+        return false
+    }
+    for _, label := range strings.Split(d, ".") {
+        if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+            return false
+        }
+        for i := 0; i < len(label); i++ {
+            c := label[i]
+            if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+                return false
+            }
+        }
+    }
+    return true
+}
@@ -0,0 +1,84 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Cookie request field parsing
+func Test_Parse_Cookies(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Cookie", `session=abc123; theme="dark"; bad name=x; empty=; noequals; x=a,b`)
+	h.Add("Cookie", "lang=en")
+	cookies := h.Cookies()
+	require.Len(t, cookies, 4)
+	assert.Equal(t, Cookie{Name: "session", Value: "abc123"}, *cookies[0])
+	assert.Equal(t, Cookie{Name: "theme", Value: "dark"}, *cookies[1])
+	assert.Equal(t, Cookie{Name: "empty", Value: ""}, *cookies[2])
+	assert.Equal(t, Cookie{Name: "lang", Value: "en"}, *cookies[3])
+
+	c, ok := h.Cookie("lang")
+	require.True(t, ok)
+	assert.Equal(t, "en", c.Value)
+	_, ok = h.Cookie("Lang")
+	assert.False(t, ok)
+}
+
+// Test: Set-Cookie serialization with every attribute
+func Test_Set_Cookie_Value(t *testing.T) {
+	c := &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Domain:      ".example.com",
+		Path:        "/docs",
+		Expires:     time.Date(2015, 10, 21, 7, 28, 0, 0, time.FixedZone("CEST", 2*3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	v, err := c.SetCookieValue()
+	require.NoError(t, err)
+	assert.Equal(t, "id=a3fWa; Domain=example.com; Path=/docs; Expires=Wed, 21 Oct 2015 05:28:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", v)
+
+	assert.Equal(t, "id=; Max-Age=0; SameSite=Strict", (&Cookie{Name: "id", MaxAge: -1, SameSite: SameSiteStrict}).String())
+	assert.Equal(t, "a=b; SameSite=Lax", (&Cookie{Name: "a", Value: "b", SameSite: SameSiteLax}).String())
+
+	h := NewHeaders()
+	require.NoError(t, h.AddCookie(&Cookie{Name: "a", Value: "1"}))
+	require.NoError(t, h.AddCookie(&Cookie{Name: "b", Value: "2", HttpOnly: true}))
+	assert.Equal(t, []string{"a=1", "b=2; HttpOnly"}, h.Values("Set-Cookie"))
+}
+
+// Test: Cookies that would inject fields or attributes are rejected
+func Test_Set_Cookie_Rejects_Injection(t *testing.T) {
+	bad := []*Cookie{
+		{Name: "", Value: "v"},
+		{Name: "a b", Value: "v"},
+		{Name: "a=b", Value: "v"},
+		{Name: "a", Value: "v\r\nSet-Cookie: evil=1"},
+		{Name: "a", Value: "v; Domain=evil.com"},
+		{Name: "a", Value: "has space"},
+		{Name: "a", Value: `q"uote`},
+		{Name: "a", Value: "v", Path: "/; Secure"},
+		{Name: "a", Value: "v", Path: "/\n"},
+		{Name: "a", Value: "v", Domain: "evil.com; Path=/"},
+		{Name: "a", Value: "v", Domain: "-bad.com"},
+		{Name: "a", Value: "v", SameSite: SameSiteNone},
+		{Name: "a", Value: "v", Partitioned: true},
+		{Name: "a", Value: "v", SameSite: SameSite(9)},
+		{Name: "a", Value: "v", Expires: time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range bad {
+		_, err := c.SetCookieValue()
+		assert.ErrorIs(t, err, ErrInvalidCookie, "%+v", *c)
+		assert.Empty(t, c.String())
+		h := NewHeaders()
+		assert.Error(t, h.AddCookie(c))
+		assert.False(t, h.Has("Set-Cookie"))
+	}
+}
@@ -0,0 +1,69 @@
+package headers
+
+import (
+    "errors"
+    "fmt"
+    "time"
+)
+
+// ErrInvalidDate is returned by ParseTime for a value in none of the
+// HTTP-date formats.
+var ErrInvalidDate = errors.New("invalid HTTP-date")
+
+// TimeFormat is the IMF-fixdate layout of RFC 9110 section 5.6.7, the only
+// format a sender may generate. Times must be in UTC when formatted with it.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// Obsolete HTTP-date layouts that recipients must still accept.
+const (
+    rfc850Format  = "Monday, 02-Jan-06 15:04:05 GMT"
+    asctimeFormat = "Mon Jan _2 15:04:05 2006"
+)
+
+// FormatTime returns t as an IMF-fixdate, as used in Date, Last-Modified
+// and Expires.
+func FormatTime(t time.Time) string {
+    return t.UTC().Format(TimeFormat)
+}
+
+// ParseTime parses an HTTP-date in any of the three formats of RFC 9110
+// section 5.6.7: IMF-fixdate, the obsolete RFC 850 format and ANSI C's
+// asctime() format. A two-digit RFC 850 year that would be more than 50
+// years in the future is taken to be in the past century. The result is
+// in UTC.
+func ParseTime(v string) (time.Time, error) {
+    if t, err := time.Parse(TimeFormat, v); err == nil {
+        return t, nil
+    }
+    if t, err := time.Parse(rfc850Format, v); err == nil {
+        return fixTwoDigitYear(t, time.Now().UTC().Year()), nil
+    }
+    if t, err := time.Parse(asctimeFormat, v); err == nil {
+        return t, nil
+    }
+    return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidDate, v)
+}
+
+// Time parses the HTTP-date in field key of h, such as If-Modified-Since.
+// It reports false if the field is missing, repeated or not a valid date.
+func (h *Headers) Time(key string) (time.Time, bool) {
+    vs := h.Values(key)
+    if len(vs) != 1 {
+        return time.Time{}, false
+    }
+    t, err := ParseTime(vs[0])
+    if err != nil {
+        return time.Time{}, false
+    }
+    return t, true
+}
+
+// fixTwoDigitYear places the two-digit year of t in the century that
+// keeps it no more than 50 years after thisYear.
+func fixTwoDigitYear(t time.Time, thisYear int) time.Time {
+    year := thisYear/100*100 + t.Year()%100
+    if year > thisYear+50 {
+        year -= 100
+    }
+    return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
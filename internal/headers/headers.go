@@ -6,36 +6,318 @@ import (
     "strings"
 )
 
-// Headers represents a simple HTTP headers map.
-type Headers map[string]string
+var (
+    // ErrMissingColon is returned for a header line without a colon.
+    ErrMissingColon = errors.New("invalid header: missing colon")
+    // ErrSpaceBeforeColon is returned when whitespace separates the name and colon.
+    ErrSpaceBeforeColon = errors.New("invalid header: space before colon")
+    // ErrEmptyKey is returned for a header line with an empty name.
+    ErrEmptyKey = errors.New("invalid header: empty key")
+    // ErrInvalidKey is returned when the name contains a character not allowed in it.
+    ErrInvalidKey = errors.New("invalid header: invalid character in key")
+    // ErrInvalidValue is returned when the value contains a control character.
+    ErrInvalidValue = errors.New("invalid header: invalid character in value")
+    // ErrObsFold is returned in Strict mode for a line starting with
+    // whitespace, which is obsolete line folding.
+    ErrObsFold = errors.New("invalid header: obsolete line folding")
+)
+
+// Field is a single field line: a name and one value.
+type Field struct {
+    Name  string
+    Value string
+}
+
+// Headers represents HTTP header fields as an ordered list of field lines,
+// so that a section can be written back in the order it was received.
+// Parsed names keep the casing they arrived with; names given to Set and
+// Add are stored in canonical form (see CanonicalKey). Every method
+// matches names case-insensitively. The zero value is an empty Headers
+// ready to use.
+type Headers struct {
+    fields []Field
+}
+
+// NewHeaders creates an empty Headers.
+func NewHeaders() *Headers {
+    return &Headers{}
+}
+
+// Get returns the values for the provided key, case-insensitive, joined
+// with ", ". That is the combined form RFC 9110 allows for list-based
+// fields; use Values for fields such as Set-Cookie that cannot be combined.
+func (h *Headers) Get(key string) string {
+    var out string
+    found := false
+    for _, f := range h.list() {
+        if !equalFold(f.Name, key) {
+            continue
+        }
+        if found {
+            out += ", " + f.Value
+        } else {
+            out = f.Value
+            found = true
+        }
+    }
+    return out
+}
+
+// Values returns all values for the provided key, case-insensitive, in the
+// order they were added.
+func (h *Headers) Values(key string) []string {
+    var out []string
+    for _, f := range h.list() {
+        if equalFold(f.Name, key) {
+            out = append(out, f.Value)
+        }
+    }
+    return out
+}
 
-// NewHeaders creates an empty Headers map.
-func NewHeaders() Headers {
-    return make(Headers)
+// Has reports whether the header key is present, case-insensitive.
+func (h *Headers) Has(key string) bool {
+    for _, f := range h.list() {
+        if equalFold(f.Name, key) {
+            return true
+        }
+    }
+    return false
 }
 
-// Get returns the value for the provided key, case-insensitive.
-func (h Headers) Get(key string) string {
-    return h[strings.ToLower(key)]
+// Set sets or overrides the header key with the provided value. An
+// existing field keeps its position; any further lines for the key are
+// removed.
+func (h *Headers) Set(key, value string) {
+    for i, f := range h.fields {
+        if equalFold(f.Name, key) {
+            h.fields[i].Value = value
+            h.delFrom(key, i+1)
+            return
+        }
+    }
+    h.append(Field{Name: CanonicalKey(key), Value: value})
 }
 
-// Set sets or overrides the header key with the provided value.
-// It preserves the key's case, intended for response headers.
-func (h Headers) Set(key, value string) {
-    h[key] = value
+// Add appends a field line for the header key.
+func (h *Headers) Add(key, value string) {
+    h.append(Field{Name: CanonicalKey(key), Value: value})
 }
 
-// Parse consumes at most one header line from data and updates the map.
+// initialFields is the capacity first given to the field lines, enough for
+// a typical request without growing.
+const initialFields = 16
+
+// append adds f after the existing field lines.
+func (h *Headers) append(f Field) {
+    if h.fields == nil {
+        h.fields = make([]Field, 0, initialFields)
+    }
+    h.fields = append(h.fields, f)
+}
+
+// Del removes all values of the header key, case-insensitive.
+func (h *Headers) Del(key string) {
+    h.delFrom(key, 0)
+}
+
+// delFrom removes the lines for key at or after index i.
+func (h *Headers) delFrom(key string, i int) {
+    out := h.fields[:i]
+    for _, f := range h.fields[i:] {
+        if !equalFold(f.Name, key) {
+            out = append(out, f)
+        }
+    }
+    for j := len(out); j < len(h.fields); j++ {
+        h.fields[j] = Field{}
+    }
+    h.fields = out
+}
+
+// Len returns the number of field lines.
+func (h *Headers) Len() int {
+    return len(h.list())
+}
+
+// Fields returns a copy of the field lines in order.
+func (h *Headers) Fields() []Field {
+    return append([]Field(nil), h.list()...)
+}
+
+// Keys returns the distinct field names in the order they first appear,
+// each with the casing of its first line.
+func (h *Headers) Keys() []string {
+    var keys []string
+    for i, f := range h.list() {
+        seen := false
+        for _, g := range h.fields[:i] {
+            if equalFold(f.Name, g.Name) {
+                seen = true
+                break
+            }
+        }
+        if !seen {
+            keys = append(keys, f.Name)
+        }
+    }
+    return keys
+}
+
+// list returns the field lines, allowing a nil *Headers to read as empty.
+func (h *Headers) list() []Field {
+    if h == nil {
+        return nil
+    }
+    return h.fields
+}
+
+// equalFold reports whether two field names are equal ignoring ASCII case.
+func equalFold(a, b string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := 0; i < len(a); i++ {
+        x, y := a[i], b[i]
+        if x >= 'A' && x <= 'Z' {
+            x += 'a' - 'A'
+        }
+        if y >= 'A' && y <= 'Z' {
+            y += 'a' - 'A'
+        }
+        if x != y {
+            return false
+        }
+    }
+    return true
+}
+
+// canonicalExceptions lists common fields whose conventional spelling does
+// not follow the capitalize-after-dash rule.
+var canonicalExceptions = map[string]string{
+    "Content-Md5":      "Content-MD5",
+    "Dnt":              "DNT",
+    "Etag":             "ETag",
+    "Te":               "TE",
+    "Www-Authenticate": "WWW-Authenticate",
+    "X-Xss-Protection": "X-XSS-Protection",
+}
+
+// CanonicalKey returns the canonical form of a field name: the first
+// letter and any letter following a '-' are upper case, the rest lower
+// case, as in "Content-Type". A few well-known names keep their
+// conventional spelling, such as "ETag". Names containing characters that
+// are not valid in a field name are returned unchanged.
+func CanonicalKey(key string) string {
+    upper := true
+    canonical := true
+    for i := 0; i < len(key); i++ {
+        c := key[i]
+        if !isTokenChar(c) {
+            return key
+        }
+        if upper && c >= 'a' && c <= 'z' || !upper && c >= 'A' && c <= 'Z' {
+            canonical = false
+        }
+        upper = c == '-'
+    }
+    if canonical {
+        if v, ok := canonicalExceptions[key]; ok {
+            return v
+        }
+        return key
+    }
+    b := []byte(key)
+    upper = true
+    for i, c := range b {
+        if upper && c >= 'a' && c <= 'z' {
+            b[i] = c - ('a' - 'A')
+        } else if !upper && c >= 'A' && c <= 'Z' {
+            b[i] = c + ('a' - 'A')
+        }
+        upper = c == '-'
+    }
+    key = string(b)
+    if v, ok := canonicalExceptions[key]; ok {
+        return v
+    }
+    return key
+}
+
+// Clone returns a copy of h, keeping order and casing.
+func (h *Headers) Clone() *Headers {
+    if h == nil {
+        return nil
+    }
+    return &Headers{fields: h.Fields()}
+}
+
+// Mode selects how a Parser treats obsolete or unsafe constructs.
+type Mode int
+
+const (
+    // Strict rejects obsolete line folding, whitespace before a field
+    // name, and control characters in field values.
+    Strict Mode = iota
+    // Lenient unfolds obsolete line folding into a single space and
+    // replaces control characters in field values with a space, as RFC 9110
+    // section 5.5 permits.
+    Lenient
+)
+
+// Parser parses a header or trailer section line by line. It remembers the
+// previous field so that obsolete line folding can be recognized, and how
+// much of an incomplete line it has already scanned, so that a line
+// arriving over several reads is searched only once. Each call must be
+// given data starting at the first byte not yet consumed. Use a new Parser
+// for every section.
+type Parser struct {
+    Mode Mode
+    // inField is set once a field line has been parsed, so that a line
+    // starting with whitespace can continue it.
+    inField bool
+    // scanned is the number of bytes of an incomplete line known not to
+    // hold its CRLF.
+    scanned int
+}
+
+// Parse consumes at most one header line from data and appends it to h.
 // It returns n (bytes consumed), done (true iff an empty line was found), and err.
+// It uses a Strict Parser, so control characters in values are rejected.
+// Having no memory of previous lines, it cannot recognize obsolete line
+// folding: whitespace before a field name is skipped and the line parsed
+// as a field of its own. Use a Parser to parse a whole section, or to
+// choose Lenient handling.
 // Behavior:
 // - If no CRLF is found, returns (0, false, nil) and consumes nothing.
 // - If CRLF is at the start ("\r\n"), returns (2, true, nil) indicating end of headers.
 // - Otherwise parses a single "key: value" line. Leading/trailing whitespace around
 //   key and value is trimmed, but there must be no whitespace immediately before the colon.
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-    // Find the end of the next line.
-    crlf := []byte("\r\n")
-    idx := bytes.Index(data, crlf)
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+    skip := 0
+    for skip < len(data) && (data[skip] == ' ' || data[skip] == '\t') {
+        skip++
+    }
+    if skip == len(data) || data[skip] == '\r' {
+        // Blank or whitespace-only line: let the parser report it.
+        skip = 0
+    }
+    var p Parser
+    n, done, err = p.Parse(h, data[skip:])
+    if n > 0 {
+        n += skip
+    }
+    return n, done, err
+}
+
+// Parse consumes at most one header line from data and appends it to h,
+// keeping the field name as it was received. It returns the same results
+// as Headers.Parse. Field names must be tokens and field values may hold
+// visible ASCII, SP, HTAB and obs-text; other bytes are handled according
+// to p.Mode.
+func (p *Parser) Parse(h *Headers, data []byte) (n int, done bool, err error) {
+    // Find the end of the next line, resuming where the last call stopped.
+    idx := p.lineEnd(data)
     if idx == -1 {
         return 0, false, nil
     }
@@ -45,50 +327,162 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
     }
 
     line := data[:idx]
+    if line[0] == ' ' || line[0] == '\t' {
+        // Whitespace before the first field line cannot be obs-fold and
+        // must not be trimmed into a field of its own (RFC 9112, 2.2).
+        if p.Mode == Strict || !p.inField || len(h.fields) == 0 {
+            return 0, false, ErrObsFold
+        }
+        // obs-fold: the line continues the previous field value.
+        val, err := p.fieldValue(line)
+        if err != nil {
+            return 0, false, err
+        }
+        last := &h.fields[len(h.fields)-1]
+        if val != "" {
+            if last.Value == "" {
+                last.Value = val
+            } else {
+                last.Value += " " + val
+            }
+        }
+        return idx + 2, false, nil
+    }
+
     // Split on the first ':' only (values can contain ':').
     colon := bytes.IndexByte(line, ':')
     if colon == -1 {
-        return 0, false, errors.New("invalid header: missing colon")
+        return 0, false, ErrMissingColon
     }
     // Enforce no whitespace between key and colon.
     if colon > 0 {
         prev := line[colon-1]
         if prev == ' ' || prev == '\t' {
-            return 0, false, errors.New("invalid header: space before colon")
+            return 0, false, ErrSpaceBeforeColon
         }
     }
 
-    rawKey := string(line[:colon])
-    rawVal := string(line[colon+1:])
+    name := line[:colon]
+    if len(name) == 0 {
+        return 0, false, ErrEmptyKey
+    }
+    for _, c := range name {
+        if !isTokenChar(c) {
+            return 0, false, ErrInvalidKey
+        }
+    }
+    key := internName(name)
+    val, err := p.fieldValue(line[colon+1:])
+    if err != nil {
+        return 0, false, err
+    }
+
+    // Keep the name as received and repeated fields as separate lines.
+    h.append(Field{Name: key, Value: val})
+    p.inField = true
 
-    key := strings.TrimSpace(rawKey)
-    val := strings.TrimSpace(rawVal)
-    if key == "" {
-        return 0, false, errors.New("invalid header: empty key")
+    // Consume exactly this line and its CRLF, not beyond.
+    return idx + 2, false, nil
+}
+
+// lineEnd returns the index of the CRLF ending the first line of data, or
+// -1 if data holds no complete line yet. A bare LF does not end a line.
+func (p *Parser) lineEnd(data []byte) int {
+    from := p.scanned
+    if from > len(data) {
+        from = 0
     }
+    for {
+        i := bytes.IndexByte(data[from:], '\n')
+        if i == -1 {
+            // Keep the last byte: it may be the CR of a CRLF.
+            if len(data) > 0 {
+                p.scanned = len(data) - 1
+            }
+            return -1
+        }
+        i += from
+        if i > 0 && data[i-1] == '\r' {
+            p.scanned = 0
+            return i - 1
+        }
+        from = i + 1
+    }
+}
 
-    // Validate key characters (letters, digits, and '-').
-    for i := 0; i < len(key); i++ {
-        c := key[i]
-        if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
-            return 0, false, errors.New("invalid header: invalid character in key")
+// fieldValue checks the bytes of raw and trims optional whitespace around it.
+func (p *Parser) fieldValue(raw []byte) (string, error) {
+    for i, c := range raw {
+        if isFieldValueByte(c) {
+            continue
+        }
+        if p.Mode == Strict {
+            return "", ErrInvalidValue
+        }
+        // Replace control characters without modifying the caller's data.
+        out := make([]byte, len(raw))
+        copy(out, raw)
+        for j := i; j < len(out); j++ {
+            if !isFieldValueByte(out[j]) {
+                out[j] = ' '
+            }
         }
+        raw = out
+        break
     }
+    return internValue(trimOWS(raw)), nil
+}
 
-    // Normalize key to lowercase before storing.
-    key = strings.ToLower(key)
+// trimOWS removes spaces and tabs from both ends of b.
+func trimOWS(b []byte) []byte {
+    for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+        b = b[1:]
+    }
+    for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+        b = b[:len(b)-1]
+    }
+    return b
+}
 
-    // Mutate the headers map with the parsed key/value.
-    if prev, ok := h[key]; ok {
-        if prev == "" {
-            h[key] = val
-        } else {
-            h[key] = prev + "," + val
+// isFieldValueByte reports whether c may appear in a field value:
+// VCHAR, SP, HTAB or obs-text.
+func isFieldValueByte(c byte) bool {
+    return c == ' ' || c == '\t' || c > 0x20 && c != 0x7f
+}
+
+// ValidFieldName reports whether name is a token as required for a field
+// name by RFC 9110 section 5.1.
+func ValidFieldName(name string) bool {
+    if name == "" {
+        return false
+    }
+    for i := 0; i < len(name); i++ {
+        if !isTokenChar(name[i]) {
+            return false
         }
-    } else {
-        h[key] = val
     }
+    return true
+}
 
-    // Consume exactly this line and its CRLF, not beyond.
-    return idx + 2, false, nil
+// ValidFieldValue reports whether v can be sent as a field value: it may
+// hold visible ASCII, SP, HTAB and obs-text, but no CR, LF, NUL or other
+// control characters.
+func ValidFieldValue(v string) bool {
+    for i := 0; i < len(v); i++ {
+        if !isFieldValueByte(v[i]) {
+            return false
+        }
+    }
+    return true
+}
+
+// ContainsToken reports whether the comma-separated list in value contains
+// token, compared case-insensitively, as used by Connection and similar fields.
+func ContainsToken(value, token string) bool {
+    for _, part := range strings.Split(value, ",") {
+        if strings.EqualFold(strings.TrimSpace(part), token) {
+            return true
+        }
+    }
+    return false
 }
@@ -2,7 +2,9 @@ package headers
 
 import (
 	"bytes"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -11,12 +13,14 @@ import (
 // Test: Valid single header
 func Test_Valid_Single_Header(t *testing.T) {
 	headers := NewHeaders()
-	// Mixed case key should be normalized to lowercase in map
+	// Mixed case key is matched case-insensitively and kept as received
 	data := []byte("HoSt: localhost:42069\r\n\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("Host"))
+	assert.Equal(t, []Field{{Name: "HoSt", Value: "localhost:42069"}}, headers.Fields())
 	// Consume only the first CRLF-terminated line, not the trailing CRLF
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
@@ -28,7 +32,7 @@ func Test_Valid_Single_Header_With_Extra_Whitespace(t *testing.T) {
 	data := []byte(" hOsT:    localhost:42069   \r\n\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	// n should be up to the first CRLF
 	exp := bytes.Index(data, []byte("\r\n")) + 2
 	assert.Equal(t, exp, n)
@@ -38,7 +42,7 @@ func Test_Valid_Single_Header_With_Extra_Whitespace(t *testing.T) {
 // Test: Valid 2 headers with existing headers
 func Test_Valid_Two_Headers_With_Existing(t *testing.T) {
 	headers := NewHeaders()
-	headers["existing"] = "foo"
+	headers.Set("existing", "foo")
 
 	data := []byte("HOST: localhost:42069\r\nUser-AGENT: curl\r\n\r\n")
 
@@ -46,14 +50,14 @@ func Test_Valid_Two_Headers_With_Existing(t *testing.T) {
 	n1, done1, err1 := headers.Parse(data)
 	require.NoError(t, err1)
 	assert.False(t, done1)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, "foo", headers["existing"]) // still present
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
+	assert.Equal(t, "foo", headers.Get("existing")) // still present
 
 	// Second header
 	n2, done2, err2 := headers.Parse(data[n1:])
 	require.NoError(t, err2)
 	assert.False(t, done2)
-	assert.Equal(t, "curl", headers["user-agent"])
+	assert.Equal(t, "curl", headers.Get("user-agent"))
 
 	// Following should signal done (empty line)
 	n3, done3, err3 := headers.Parse(data[n1+n2:])
@@ -92,10 +96,10 @@ func Test_Invalid_Character_In_Key(t *testing.T) {
 	assert.False(t, done)
 }
 
-// Test: Append value when key already exists
+// Test: Add value when key already exists
 func Test_Append_To_Existing_Header(t *testing.T) {
 	headers := NewHeaders()
-	headers["host"] = "alpha"
+	headers.Set("host", "alpha")
 
 	data := []byte("Host: beta\r\n\r\n")
 	n, done, err := headers.Parse(data)
@@ -103,5 +107,406 @@ func Test_Append_To_Existing_Header(t *testing.T) {
 	assert.False(t, done)
 	exp := bytes.Index(data, []byte("\r\n")) + 2
 	assert.Equal(t, exp, n)
-	assert.Equal(t, "alpha,beta", headers["host"]) // appended with comma
+	assert.Equal(t, []string{"alpha", "beta"}, headers.Values("host")) // kept as separate values
+	assert.Equal(t, "alpha, beta", headers.Get("host"))
+}
+
+// Test: Media type parsing
+func Test_Parse_Media_Type(t *testing.T) {
+	mt, params, err := ParseMediaType(`Multipart/Form-Data; Boundary="a \"b\" c"; charset=utf-8`)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mt)
+	assert.Equal(t, `a "b" c`, params["boundary"])
+	assert.Equal(t, "utf-8", params["charset"])
+
+	mt, params, err = ParseMediaType(`form-data; name="file"; filename="a.txt"`)
+	require.NoError(t, err)
+	assert.Equal(t, "form-data", mt)
+	assert.Equal(t, "file", params["name"])
+	assert.Equal(t, "a.txt", params["filename"])
+
+	for _, bad := range []string{"", "/plain", "text/", "text/plain; charset", `text/plain; a="x`, "text/plain; a=1; a=2", "text/plain junk"} {
+		_, _, err := ParseMediaType(bad)
+		assert.ErrorIs(t, err, ErrInvalidMediaType, bad)
+	}
+}
+
+// Test: Multi-valued helpers
+func Test_Add_Values_Del_Clone(t *testing.T) {
+	h := NewHeaders()
+	h.Add("set-cookie", "a=1; Path=/")
+	h.Add("set-cookie", "b=2, with comma")
+	assert.Equal(t, []string{"a=1; Path=/", "b=2, with comma"}, h.Values("set-cookie"))
+
+	c := h.Clone()
+	c.Add("set-cookie", "c=3")
+	c.Set("x-only-clone", "1")
+	assert.Len(t, h.Values("set-cookie"), 2)
+	assert.Empty(t, h.Get("x-only-clone"))
+
+	h.Set("set-cookie", "only")
+	assert.Equal(t, []string{"only"}, h.Values("set-cookie"))
+	h.Del("set-cookie")
+	assert.Nil(t, h.Values("set-cookie"))
+	assert.Len(t, c.Values("set-cookie"), 3)
+}
+
+// Test: Canonical keys
+func Test_Canonical_Key(t *testing.T) {
+	assert.Equal(t, "Content-Type", CanonicalKey("content-type"))
+	assert.Equal(t, "Content-Type", CanonicalKey("CONTENT-TYPE"))
+	assert.Equal(t, "X-Custom-Id", CanonicalKey("x-custom-ID"))
+	assert.Equal(t, "ETag", CanonicalKey("etag"))
+	assert.Equal(t, "WWW-Authenticate", CanonicalKey("www-authenticate"))
+	// Invalid names are left alone.
+	assert.Equal(t, "bad key", CanonicalKey("bad key"))
+}
+
+// Test: Set then Get works regardless of the casing used
+func Test_Set_Get_Case_Insensitive(t *testing.T) {
+	h := NewHeaders()
+	h.Set("Content-Type", "text/html")
+	assert.Equal(t, "text/html", h.Get("Content-Type"))
+	assert.Equal(t, "text/html", h.Get("content-type"))
+	assert.True(t, h.Has("CONTENT-TYPE"))
+	h.Add("content-TYPE", "text/plain")
+	assert.Equal(t, []string{"text/html", "text/plain"}, h.Values("Content-Type"))
+	assert.Equal(t, 1, len(h.Keys()))
+	h.Del("CONTENT-type")
+	assert.False(t, h.Has("Content-Type"))
+}
+
+// Test: Field-name and field-value conformance corpus (RFC 9110 section 5)
+func Test_Field_Conformance_Corpus(t *testing.T) {
+	cases := []struct {
+		name    string
+		lines   string
+		key     string
+		strict  []string // expected values in Strict mode; nil means an error
+		lenient []string // expected values in Lenient mode; nil means an error
+		err     error    // expected Strict error
+	}{
+		{"underscore in name", "X_Custom: 1\r\n", "X_custom", []string{"1"}, []string{"1"}, nil},
+		{"bang in name", "Accept!: 1\r\n", "Accept!", []string{"1"}, []string{"1"}, nil},
+		{"all tchar symbols", "!#$%&'*+-.^_`|~: v\r\n", "!#$%&'*+-.^_`|~", []string{"v"}, []string{"v"}, nil},
+		{"digits in name", "X-123: v\r\n", "X-123", []string{"v"}, []string{"v"}, nil},
+		{"empty value", "X-Empty:\r\n", "X-Empty", []string{""}, []string{""}, nil},
+		{"inner whitespace kept", "X-A: a \t b\r\n", "X-A", []string{"a \t b"}, []string{"a \t b"}, nil},
+		{"obs-text value", "X-A: caf\xe9\r\n", "X-A", []string{"caf\xe9"}, []string{"caf\xe9"}, nil},
+		{"tab around value", "X-A:\tv\t\r\n", "X-A", []string{"v"}, []string{"v"}, nil},
+		{"colon in value", "X-A: a:b:c\r\n", "X-A", []string{"a:b:c"}, []string{"a:b:c"}, nil},
+		{"NUL in value", "X-A: a\x00b\r\n", "X-A", nil, []string{"a b"}, ErrInvalidValue},
+		{"bare CR in value", "X-A: a\rb\r\n", "X-A", nil, []string{"a b"}, ErrInvalidValue},
+		{"bare LF in value", "X-A: a\nX-B: b\r\n", "X-A", nil, []string{"a X-B: b"}, ErrInvalidValue},
+		{"DEL in value", "X-A: a\x7fb\r\n", "X-A", nil, []string{"a b"}, ErrInvalidValue},
+		{"ESC in value", "X-A: \x1b[31m\r\n", "X-A", nil, []string{"[31m"}, ErrInvalidValue},
+		{"obs-fold", "X-A: one\r\n two\r\n", "X-A", nil, []string{"one two"}, ErrObsFold},
+		{"obs-fold with tab", "X-A: one\r\n\t\ttwo\r\n", "X-A", nil, []string{"one two"}, ErrObsFold},
+		{"obs-fold of empty value", "X-A:\r\n two\r\n", "X-A", nil, []string{"two"}, ErrObsFold},
+	}
+	for _, tc := range cases {
+		for _, mode := range []Mode{Strict, Lenient} {
+			want := tc.strict
+			if mode == Lenient {
+				want = tc.lenient
+			}
+			h := NewHeaders()
+			p := &Parser{Mode: mode}
+			data := []byte(tc.lines + "\r\n")
+			var err error
+			for {
+				var n int
+				var done bool
+				n, done, err = p.Parse(h, data)
+				if err != nil || done {
+					break
+				}
+				data = data[n:]
+			}
+			if want == nil {
+				assert.ErrorIs(t, err, tc.err, tc.name)
+				continue
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, want, h.Values(tc.key), "%s (mode %d)", tc.name, mode)
+		}
+	}
+}
+
+// Test: Invalid field names are rejected in every mode
+func Test_Invalid_Field_Names(t *testing.T) {
+	for _, line := range []string{
+		"X(A): v\r\n",
+		"X/A: v\r\n",
+		"X\"A: v\r\n",
+		"X A: v\r\n",
+		"X@A: v\r\n",
+		"X\x00A: v\r\n",
+		"\xc3\xa9: v\r\n",
+		"{}: v\r\n",
+	} {
+		for _, mode := range []Mode{Strict, Lenient} {
+			p := &Parser{Mode: mode}
+			_, _, err := p.Parse(NewHeaders(), []byte(line))
+			assert.Error(t, err, "%q", line)
+		}
+	}
+}
+
+// Test: Strict mode rejects whitespace before the first field name
+func Test_Strict_Leading_Whitespace(t *testing.T) {
+	p := &Parser{}
+	_, _, err := p.Parse(NewHeaders(), []byte(" Transfer-Encoding: chunked\r\n"))
+	assert.ErrorIs(t, err, ErrObsFold)
+}
+
+// Test: Value validation helpers
+func Test_Valid_Field_Name_And_Value(t *testing.T) {
+	assert.True(t, ValidFieldName("X_Custom"))
+	assert.False(t, ValidFieldName(""))
+	assert.False(t, ValidFieldName("Bad Name"))
+	assert.True(t, ValidFieldValue("text/html; charset=utf-8"))
+	assert.False(t, ValidFieldValue("a\r\nSet-Cookie: x=1"))
+	assert.False(t, ValidFieldValue("a\x00"))
+}
+
+// Test: Headers.Parse is strict about field values
+func Test_Headers_Parse_Strict(t *testing.T) {
+	for _, line := range []string{"X-A: a\x00b\r\n", "X-A: a\x01\r\n", "X-A: a\rb\r\n", " \r\n"} {
+		h := NewHeaders()
+		_, _, err := h.Parse([]byte(line))
+		assert.Error(t, err, "%q", line)
+		assert.Equal(t, 0, h.Len(), "%q", line)
+	}
+}
+
+// Test: Field lines keep their order and casing
+func Test_Ordered_Fields(t *testing.T) {
+	h := NewHeaders()
+	data := []byte("user-agent: curl\r\nX-B: 1\r\nHOST: a\r\nx-b: 2\r\n\r\n")
+	for {
+		n, done, err := h.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, []Field{
+		{Name: "user-agent", Value: "curl"},
+		{Name: "X-B", Value: "1"},
+		{Name: "HOST", Value: "a"},
+		{Name: "x-b", Value: "2"},
+	}, h.Fields())
+	assert.Equal(t, []string{"user-agent", "X-B", "HOST"}, h.Keys())
+	assert.Equal(t, "1, 2", h.Get("x-b"))
+
+	// Set keeps the position of the first line and drops the rest.
+	h.Set("X-B", "3")
+	h.Add("accept", "*/*")
+	assert.Equal(t, []Field{
+		{Name: "user-agent", Value: "curl"},
+		{Name: "X-B", Value: "3"},
+		{Name: "HOST", Value: "a"},
+		{Name: "Accept", Value: "*/*"},
+	}, h.Fields())
+
+	c := h.Clone()
+	h.Del("host")
+	assert.Equal(t, 3, h.Len())
+	assert.Equal(t, 4, c.Len())
+	assert.Equal(t, "HOST", c.Fields()[2].Name)
+}
+
+// Test: A nil or zero Headers reads as empty
+func Test_Zero_Headers(t *testing.T) {
+	var nilHeaders *Headers
+	assert.Equal(t, "", nilHeaders.Get("Host"))
+	assert.False(t, nilHeaders.Has("Host"))
+	assert.Nil(t, nilHeaders.Clone())
+
+	var h Headers
+	h.Add("Host", "a")
+	assert.Equal(t, "a", h.Get("host"))
+}
+
+// Test: Preference lists with weights
+func Test_Parse_Preferences(t *testing.T) {
+	prefs, err := ParsePreferences(`text/html;level=1, text/*;q=0.5;ext="a,b", , */*;q=0`)
+	require.NoError(t, err)
+	require.Len(t, prefs, 3)
+	assert.Equal(t, Preference{Value: "text/html", Params: map[string]string{"level": "1"}, Q: 1}, prefs[0])
+	assert.Equal(t, Preference{Value: "text/*", Q: 0.5}, prefs[1])
+	assert.Equal(t, Preference{Value: "*/*", Q: 0}, prefs[2])
+
+	for _, bad := range []string{"gzip;q=2", "gzip;q=0.1234", "gzip;q=1.5", "gzip;q=", "gzip;=1", ";q=1", "en us"} {
+		_, err := ParsePreferences(bad)
+		assert.ErrorIs(t, err, ErrInvalidPreference, bad)
+	}
+}
+
+// Test: Content type negotiation
+func Test_Negotiate_Content_Type(t *testing.T) {
+	cases := []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{"", []string{"text/html", "text/plain"}, "text/html"},
+		{"text/plain", []string{"text/html", "text/plain"}, "text/plain"},
+		{"text/*;q=0.5, text/plain", []string{"text/html", "text/plain"}, "text/plain"},
+		{"*/*;q=0.1, text/html;q=0.8", []string{"application/json", "text/html"}, "text/html"},
+		{"text/*, text/html;q=0", []string{"text/html", "text/plain"}, "text/plain"},
+		{"text/html;level=1;q=0, text/html", []string{"text/html;level=1", "text/html"}, "text/html"},
+		{"application/json", []string{"text/html", "text/plain"}, ""},
+		{"*/*;q=0", []string{"text/html"}, ""},
+		{"TEXT/HTML", []string{"text/html"}, "text/html"},
+		{"text/html;q=abc", []string{"text/plain"}, "text/plain"},
+	}
+	for _, tc := range cases {
+		h := NewHeaders()
+		if tc.accept != "" {
+			h.Set("Accept", tc.accept)
+		}
+		assert.Equal(t, tc.want, h.NegotiateContentType(tc.offers...), tc.accept)
+	}
+}
+
+// Test: Content coding negotiation
+func Test_Negotiate_Encoding(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"gzip, br;q=0.9", "gzip"},
+		{"br;q=1, gzip;q=0.5", "br"},
+		{"deflate", "identity"},
+		{"*;q=0", ""},
+		{"*;q=0, gzip", "gzip"},
+		{"identity;q=0, *;q=0.1", "gzip"},
+		{"", "identity"},
+	}
+	for _, tc := range cases {
+		h := NewHeaders()
+		h.Set("Accept-Encoding", tc.accept)
+		assert.Equal(t, tc.want, h.NegotiateEncoding("gzip", "br", "identity"), tc.accept)
+	}
+	assert.Equal(t, "gzip", NewHeaders().NegotiateEncoding("gzip", "identity"))
+}
+
+// Test: Language negotiation
+func Test_Negotiate_Language(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5", "fr"},
+		{"en", "en-GB"},
+		{"en-us, en;q=0.5", "en-US"},
+		{"de", ""},
+		{"*", "en-GB"},
+		{"en-GB;q=0, *", "en-US"},
+	}
+	for _, tc := range cases {
+		h := NewHeaders()
+		h.Set("Accept-Language", tc.accept)
+		assert.Equal(t, tc.want, h.NegotiateLanguage("en-GB", "en-US", "fr"), tc.accept)
+	}
+}
+
+// Test: HTTP-date formatting and parsing
+func Test_HTTP_Date(t *testing.T) {
+	want := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", FormatTime(want.In(time.FixedZone("EST", -5*3600))))
+	for _, v := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(v)
+		require.NoError(t, err, v)
+		assert.True(t, want.Equal(got), v)
+	}
+	for _, v := range []string{
+		"",
+		"Sun, 06 Nov 1994 08:49:37 EST",
+		"Sun, 6 Nov 1994 08:49:37 GMT",
+		"1994-11-06T08:49:37Z",
+		"Sun Nov 6 08:49:37 1994 extra",
+	} {
+		_, err := ParseTime(v)
+		assert.ErrorIs(t, err, ErrInvalidDate, v)
+	}
+
+	// Two-digit years stay within 50 years of the present.
+	y := time.Date(1994, 11, 6, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 2075, fixTwoDigitYear(y.AddDate(-19, 0, 0), 2026).Year())
+	assert.Equal(t, 1977, fixTwoDigitYear(y.AddDate(-17, 0, 0), 2026).Year())
+	assert.Equal(t, 2076, fixTwoDigitYear(y.AddDate(-18, 0, 0), 2026).Year())
+
+	h := NewHeaders()
+	h.Set("If-Modified-Since", "Sun, 06 Nov 1994 08:49:37 GMT")
+	got, ok := h.Time("if-modified-since")
+	require.True(t, ok)
+	assert.True(t, want.Equal(got))
+	h.Add("If-Modified-Since", "Sun, 06 Nov 1994 08:49:37 GMT")
+	_, ok = h.Time("If-Modified-Since")
+	assert.False(t, ok)
+	_, ok = h.Time("Last-Modified")
+	assert.False(t, ok)
+}
+
+func Test_Parse_Range(t *testing.T) {
+	tests := []struct {
+		v    string
+		want []ByteRange
+	}{
+		{"bytes=0-499", []ByteRange{{0, 500}}},
+		{"bytes=500-", []ByteRange{{500, 500}}},
+		{"bytes=-200", []ByteRange{{800, 200}}},
+		{"bytes=-5000", []ByteRange{{0, 1000}}},
+		{"bytes=900-1999", []ByteRange{{900, 100}}},
+		{"Bytes = 0-0 , 10-19,,-1", []ByteRange{{0, 1}, {10, 10}, {999, 1}}},
+		// Ranges past the end are dropped if others remain.
+		{"bytes=0-9, 2000-3000", []ByteRange{{0, 10}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.v, 1000)
+		require.NoError(t, err, tt.v)
+		assert.Equal(t, tt.want, got, tt.v)
+	}
+	assert.Equal(t, "bytes 10-19/1000", ByteRange{10, 10}.ContentRange(1000))
+
+	for _, v := range []string{"", "bytes", "items=0-1", "bytes=", "bytes=5", "bytes=a-b", "bytes=5-1", "bytes=-", "bytes=+1-2", "bytes=0-1-2"} {
+		_, err := ParseRange(v, 1000)
+		assert.ErrorIs(t, err, ErrInvalidRange, v)
+	}
+	for _, v := range []string{"bytes=1000-", "bytes=1500-2000", "bytes=-0"} {
+		_, err := ParseRange(v, 1000)
+		assert.ErrorIs(t, err, ErrUnsatisfiableRange, v)
+	}
+	_, err := ParseRange("bytes=-10", 0)
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+	_, err = ParseRange("bytes="+strings.Repeat("0-0,", maxRanges+1), 1000)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func Test_Parse_Range_Overlapping(t *testing.T) {
+	for _, v := range []string{"bytes=0-,0-,0-,0-", "bytes=0-999,-1", "bytes=0-599,400-999"} {
+		_, err := ParseRange(v, 1000)
+		assert.ErrorIs(t, err, ErrInvalidRange, v)
+	}
+	// Overlapping ranges that stay within the size are still served.
+	got, err := ParseRange("bytes=0-9,5-14", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 10}, {5, 10}}, got)
+}
+
+// Test: Lenient mode rejects whitespace before the first field line
+func Test_Parser_Lenient_Leading_Whitespace(t *testing.T) {
+	p := Parser{Mode: Lenient}
+	h := NewHeaders()
+	_, _, err := p.Parse(h, []byte(" Transfer-Encoding: chunked\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrObsFold)
+	assert.False(t, h.Has("Transfer-Encoding"))
 }
@@ -0,0 +1,119 @@
+package headers
+
+// commonNames holds the field names most requests carry, in the casings
+// clients send them, so that parsing them does not allocate.
+var commonNames = makeInternTable(
+    "Accept",
+    "Accept-Charset",
+    "Accept-Encoding",
+    "Accept-Language",
+    "Authorization",
+    "Cache-Control",
+    "Connection",
+    "Content-Disposition",
+    "Content-Encoding",
+    "Content-Length",
+    "Content-Type",
+    "Cookie",
+    "DNT",
+    "Expect",
+    "Forwarded",
+    "Host",
+    "If-Match",
+    "If-Modified-Since",
+    "If-None-Match",
+    "If-Range",
+    "If-Unmodified-Since",
+    "Keep-Alive",
+    "Origin",
+    "Pragma",
+    "Priority",
+    "Range",
+    "Referer",
+    "Sec-Fetch-Dest",
+    "Sec-Fetch-Mode",
+    "Sec-Fetch-Site",
+    "Sec-Fetch-User",
+    "TE",
+    "Trailer",
+    "Transfer-Encoding",
+    "Upgrade",
+    "Upgrade-Insecure-Requests",
+    "User-Agent",
+    "Via",
+    "X-Forwarded-For",
+    "X-Forwarded-Host",
+    "X-Forwarded-Proto",
+    "X-Request-Id",
+)
+
+// commonValues holds field values that recur across requests.
+var commonValues = makeInternTable(
+    "*/*",
+    "0",
+    "1",
+    "100-continue",
+    "?0",
+    "?1",
+    "chunked",
+    "close",
+    "cors",
+    "document",
+    "empty",
+    "gzip",
+    "gzip, deflate",
+    "gzip, deflate, br",
+    "gzip, deflate, br, zstd",
+    "keep-alive",
+    "max-age=0",
+    "navigate",
+    "no-cache",
+    "no-cors",
+    "none",
+    "same-origin",
+    "same-site",
+    "trailers",
+)
+
+// maxInternLen bounds the length of interned strings, so that long values
+// such as User-Agent are not hashed for a lookup that cannot succeed.
+const maxInternLen = 32
+
+// makeInternTable maps each string, as given and in lower case, to itself.
+func makeInternTable(names ...string) map[string]string {
+    m := make(map[string]string, 2*len(names))
+    for _, n := range names {
+        if len(n) > maxInternLen {
+            panic("headers: interned string too long: " + n)
+        }
+        m[n] = n
+        lower := []byte(n)
+        for i, c := range lower {
+            if c >= 'A' && c <= 'Z' {
+                lower[i] = c + ('a' - 'A')
+            }
+        }
+        m[string(lower)] = string(lower)
+    }
+    return m
+}
+
+// internName returns b as a string, without allocating for common names.
+func internName(b []byte) string {
+    if len(b) <= maxInternLen {
+        if s, ok := commonNames[string(b)]; ok {
+            return s
+        }
+    }
+    return string(b)
+}
+
+// internValue returns b as a string, without allocating for common values.
+func internValue(b []byte) string {
+    if len(b) <= maxInternLen {
+        if s, ok := commonValues[string(b)]; ok {
+            return s
+        }
+    }
+    return string(b)
+}
@@ -0,0 +1,111 @@
+package headers
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrInvalidMediaType is returned by ParseMediaType for a malformed value.
+var ErrInvalidMediaType = errors.New("invalid media type")
+
+// ParseMediaType parses a value of the form
+//   type [ "/" subtype ] *( OWS ";" OWS name "=" ( token / quoted-string ) )
+// as used by Content-Type and Content-Disposition. The type and parameter
+// names are lowercased; parameter values are unquoted.
+func ParseMediaType(v string) (string, map[string]string, error) {
+    v = strings.TrimSpace(v)
+    i := 0
+    for i < len(v) && (isTokenChar(v[i]) || v[i] == '/') {
+        i++
+    }
+    mediaType := strings.ToLower(v[:i])
+    if mediaType == "" || strings.HasPrefix(mediaType, "/") || strings.HasSuffix(mediaType, "/") || strings.Count(mediaType, "/") > 1 {
+        return "", nil, fmt.Errorf("%w: %q", ErrInvalidMediaType, v)
+    }
+    params := make(map[string]string)
+    rest := v[i:]
+    for {
+        rest = strings.TrimLeft(rest, " \t")
+        if rest == "" {
+            return mediaType, params, nil
+        }
+        if rest[0] != ';' {
+            return "", nil, fmt.Errorf("%w: expected ';' in %q", ErrInvalidMediaType, v)
+        }
+        rest = strings.TrimLeft(rest[1:], " \t")
+        if rest == "" {
+            // A trailing ';' is tolerated.
+            return mediaType, params, nil
+        }
+        j := 0
+        for j < len(rest) && isTokenChar(rest[j]) {
+            j++
+        }
+        name := strings.ToLower(rest[:j])
+        if name == "" || j == len(rest) || rest[j] != '=' {
+            return "", nil, fmt.Errorf("%w: malformed parameter in %q", ErrInvalidMediaType, v)
+        }
+        rest = rest[j+1:]
+        var value string
+        if rest != "" && rest[0] == '"' {
+            var ok bool
+            value, rest, ok = consumeQuotedString(rest)
+            if !ok {
+                return "", nil, fmt.Errorf("%w: unterminated quoted string in %q", ErrInvalidMediaType, v)
+            }
+        } else {
+            j = 0
+            for j < len(rest) && isTokenChar(rest[j]) {
+                j++
+            }
+            if j == 0 {
+                return "", nil, fmt.Errorf("%w: empty value for parameter %q", ErrInvalidMediaType, name)
+            }
+            value, rest = rest[:j], rest[j:]
+        }
+        if _, dup := params[name]; dup {
+            return "", nil, fmt.Errorf("%w: duplicate parameter %q", ErrInvalidMediaType, name)
+        }
+        params[name] = value
+    }
+}
+
+// consumeQuotedString reads a quoted-string at the start of s and returns
+// its unescaped content and the remainder of s.
+func consumeQuotedString(s string) (value, rest string, ok bool) {
+    var b strings.Builder
+    for i := 1; i < len(s); i++ {
+        switch c := s[i]; c {
+        case '"':
+            return b.String(), s[i+1:], true
+        case '\\':
+            if i+1 == len(s) {
+                return "", "", false
+            }
+            i++
+            b.WriteByte(s[i])
+        default:
+            b.WriteByte(c)
+        }
+    }
+    return "", "", false
+}
+
+// isTokenChar reports whether c is a tchar as defined by RFC 9110.
+func isTokenChar(c byte) bool { return tokenTable[c] }
+
+// tokenTable marks the bytes that are tchars.
+var tokenTable = func() (t [256]bool) {
+    for c := 'A'; c <= 'Z'; c++ {
+        t[c] = true
+        t[c+('a'-'A')] = true
+    }
+    for c := '0'; c <= '9'; c++ {
+        t[c] = true
+    }
+    for _, c := range []byte("!#$%&'*+-.^_`|~") {
+        t[c] = true
+    }
+    return t
+}()
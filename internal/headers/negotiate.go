@@ -0,0 +1,269 @@
+package headers
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrInvalidPreference is returned by ParsePreferences for a malformed
+// member of a preference list.
+var ErrInvalidPreference = errors.New("invalid preference list")
+
+// Preference is one member of a q-valued list as sent in Accept,
+// Accept-Encoding and Accept-Language.
+type Preference struct {
+    // Value is the media range, content coding or language range, lowercased.
+    Value string
+    // Params holds the media type parameters that precede the weight.
+    // Extension parameters after the weight are ignored.
+    Params map[string]string
+    // Q is the weight, from 0 to 1. A weight of 0 means "not acceptable".
+    Q float64
+}
+
+// ParsePreferences parses a comma-separated list of
+//   value *( OWS ";" OWS name "=" ( token / quoted-string ) )
+// members with an optional "q" weight, as defined by RFC 9110 section 12.4.
+// Empty list members are skipped. Members without a weight have Q 1.
+func ParsePreferences(v string) ([]Preference, error) {
+    var prefs []Preference
+    for _, member := range splitQuoted(v, ',') {
+        member = strings.Trim(member, " \t")
+        if member == "" {
+            continue
+        }
+        parts := splitQuoted(member, ';')
+        value := strings.ToLower(strings.Trim(parts[0], " \t"))
+        if value == "" {
+            return nil, fmt.Errorf("%w: empty value in %q", ErrInvalidPreference, member)
+        }
+        for i := 0; i < len(value); i++ {
+            if !isTokenChar(value[i]) && value[i] != '/' {
+                return nil, fmt.Errorf("%w: %q", ErrInvalidPreference, member)
+            }
+        }
+        p := Preference{Value: value, Q: 1}
+        for _, param := range parts[1:] {
+            param = strings.Trim(param, " \t")
+            if param == "" {
+                continue
+            }
+            eq := strings.IndexByte(param, '=')
+            if eq <= 0 {
+                return nil, fmt.Errorf("%w: malformed parameter in %q", ErrInvalidPreference, member)
+            }
+            name := strings.ToLower(param[:eq])
+            val := param[eq+1:]
+            if val != "" && val[0] == '"' {
+                unquoted, rest, ok := consumeQuotedString(val)
+                if !ok || rest != "" {
+                    return nil, fmt.Errorf("%w: malformed quoted string in %q", ErrInvalidPreference, member)
+                }
+                val = unquoted
+            }
+            if name == "q" {
+                q, ok := parseQValue(val)
+                if !ok {
+                    return nil, fmt.Errorf("%w: invalid weight %q", ErrInvalidPreference, val)
+                }
+                p.Q = q
+                // Anything after the weight is an extension, not a parameter.
+                break
+            }
+            if p.Params == nil {
+                p.Params = make(map[string]string)
+            }
+            p.Params[name] = val
+        }
+        prefs = append(prefs, p)
+    }
+    return prefs, nil
+}
+
+// splitQuoted splits s at every sep that is not inside a quoted-string.
+func splitQuoted(s string, sep byte) []string {
+    var parts []string
+    start := 0
+    quoted := false
+    for i := 0; i < len(s); i++ {
+        switch c := s[i]; {
+        case quoted && c == '\\':
+            i++
+        case c == '"':
+            quoted = !quoted
+        case !quoted && c == sep:
+            parts = append(parts, s[start:i])
+            start = i + 1
+        }
+    }
+    return append(parts, s[start:])
+}
+
+// parseQValue parses a weight: "0" [ "." 0*3DIGIT ] or "1" [ "." 0*3"0" ].
+func parseQValue(s string) (float64, bool) {
+    if s == "" || len(s) > 5 || s[0] != '0' && s[0] != '1' {
+        return 0, false
+    }
+    if len(s) > 1 && s[1] != '.' {
+        return 0, false
+    }
+    q := float64(s[0] - '0')
+    scale := 0.1
+    for i := 2; i < len(s); i++ {
+        c := s[i]
+        if c < '0' || c > '9' || s[0] == '1' && c != '0' {
+            return 0, false
+        }
+        q += float64(c-'0') * scale
+        scale /= 10
+    }
+    return q, true
+}
+
+// NegotiateContentType returns the offered media type the Accept field of
+// h prefers, or "" if the client accepts none of them, in which case a
+// 406 Not Acceptable response is appropriate. Each offer is weighted by
+// the most specific matching range: "type/subtype" with parameters, then
+// "type/subtype", "type/*" and "*/*". Ties go to the earlier offer. A
+// missing or malformed Accept field accepts the first offer.
+func (h *Headers) NegotiateContentType(offers ...string) string {
+    prefs, ok := h.preferences("Accept")
+    if !ok {
+        return first(offers)
+    }
+    return best(offers, func(offer string) float64 {
+        typ, params, err := ParseMediaType(offer)
+        if err != nil {
+            return 0
+        }
+        q, rank := 0.0, -1
+        for _, p := range prefs {
+            r := mediaRangeRank(p, typ, params)
+            if r > rank {
+                q, rank = p.Q, r
+            }
+        }
+        return q
+    })
+}
+
+// mediaRangeRank returns how specifically the range p matches the media
+// type typ with params, or -1 if it does not match.
+func mediaRangeRank(p Preference, typ string, params map[string]string) int {
+    rangeType, rangeSub, ok := strings.Cut(p.Value, "/")
+    offerType, offerSub, _ := strings.Cut(typ, "/")
+    if !ok {
+        return -1
+    }
+    switch {
+    case rangeType == "*" && rangeSub == "*":
+        return 0
+    case rangeType != offerType:
+        return -1
+    case rangeSub == "*":
+        return 1
+    case rangeSub != offerSub:
+        return -1
+    }
+    for name, value := range p.Params {
+        if !strings.EqualFold(params[name], value) {
+            return -1
+        }
+    }
+    return 2 + len(p.Params)
+}
+
+// NegotiateEncoding returns the offered content coding the
+// Accept-Encoding field of h prefers, or "" if none is acceptable. The
+// "identity" coding is acceptable unless the field excludes it, explicitly
+// or through "*;q=0". A missing field accepts the first offer; an empty
+// one accepts only "identity".
+func (h *Headers) NegotiateEncoding(offers ...string) string {
+    prefs, ok := h.preferences("Accept-Encoding")
+    if !ok {
+        return first(offers)
+    }
+    return best(offers, func(offer string) float64 {
+        offer = strings.ToLower(offer)
+        wildcard := -1.0
+        for _, p := range prefs {
+            if p.Value == offer {
+                return p.Q
+            }
+            if p.Value == "*" {
+                wildcard = p.Q
+            }
+        }
+        if wildcard >= 0 {
+            return wildcard
+        }
+        if offer == "identity" {
+            return 1
+        }
+        return 0
+    })
+}
+
+// NegotiateLanguage returns the offered language tag the Accept-Language
+// field of h prefers, or "" if none is acceptable. Ranges match as in RFC
+// 4647 basic filtering: "en" matches "en" and "en-GB", and "*" matches any
+// tag. Each offer is weighted by its longest matching range. A missing or
+// malformed field accepts the first offer.
+func (h *Headers) NegotiateLanguage(offers ...string) string {
+    prefs, ok := h.preferences("Accept-Language")
+    if !ok {
+        return first(offers)
+    }
+    return best(offers, func(offer string) float64 {
+        tag := strings.ToLower(offer)
+        q, rank := 0.0, -1
+        for _, p := range prefs {
+            r := -1
+            switch {
+            case p.Value == "*":
+                r = 0
+            case tag == p.Value || strings.HasPrefix(tag, p.Value+"-"):
+                r = len(p.Value)
+            }
+            if r > rank {
+                q, rank = p.Q, r
+            }
+        }
+        return q
+    })
+}
+
+// preferences parses the preference list in field key. It reports false
+// when the field is missing or malformed, which accepts any offer.
+func (h *Headers) preferences(key string) ([]Preference, bool) {
+    if !h.Has(key) {
+        return nil, false
+    }
+    prefs, err := ParsePreferences(h.Get(key))
+    if err != nil {
+        return nil, false
+    }
+    return prefs, true
+}
+
+// best returns the offer with the highest non-zero weight, preferring
+// earlier offers on ties, or "" if every weight is zero.
+func best(offers []string, weight func(string) float64) string {
+    var winner string
+    var top float64
+    for _, offer := range offers {
+        if q := weight(offer); q > top {
+            winner, top = offer, q
+        }
+    }
+    return winner
+}
+
+// first returns the first offer, or "" if there are none.
+func first(offers []string) string {
+    if len(offers) == 0 {
+        return ""
+    }
+    return offers[0]
+}
@@ -0,0 +1,127 @@
+package headers
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+var (
+    // ErrInvalidRange is returned by ParseRange for a Range value that is
+    // malformed or uses a unit other than bytes. Such a field is ignored
+    // and the full representation sent.
+    ErrInvalidRange = errors.New("invalid range")
+    // ErrUnsatisfiableRange is returned by ParseRange when no range
+    // overlaps the representation; a 416 response is appropriate.
+    ErrUnsatisfiableRange = errors.New("range not satisfiable")
+)
+
+// maxRanges bounds the number of ranges honoured in one request, since
+// many tiny ranges cost far more to serve than to ask for.
+const maxRanges = 100
+
+// ByteRange is a satisfiable range of a representation: Length bytes
+// starting at offset Start.
+type ByteRange struct {
+    Start  int64
+    Length int64
+}
+
+// ContentRange returns the Content-Range value for r within a
+// representation of size bytes, such as "bytes 0-499/1234".
+func (r ByteRange) ContentRange(size int64) string {
+    return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range value of the form
+//   "bytes=" range-spec *( OWS "," OWS range-spec )
+// for a representation of size bytes, as defined by RFC 9110 section 14.1.
+// Each range-spec is "first-last", "first-" or a suffix "-length". Ranges
+// that start past the end are dropped and ranges that end past it are
+// clamped. If every range is dropped it returns ErrUnsatisfiableRange.
+//
+// A set of ranges longer in total than the representation, which can only
+// happen when they overlap, is refused with ErrInvalidRange as RFC 9110
+// section 14.2 allows: otherwise "bytes=0-,0-,0-" would make the server
+// send the whole representation once per range.
+func ParseRange(v string, size int64) ([]ByteRange, error) {
+    unit, set, ok := strings.Cut(v, "=")
+    if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+        return nil, fmt.Errorf("%w: %q", ErrInvalidRange, v)
+    }
+    specs := strings.Split(set, ",")
+    if len(specs) > maxRanges {
+        return nil, fmt.Errorf("%w: more than %d ranges", ErrInvalidRange, maxRanges)
+    }
+    var ranges []ByteRange
+    empty := true
+    for _, spec := range specs {
+        spec = strings.Trim(spec, " \t")
+        if spec == "" {
+            continue
+        }
+        empty = false
+        first, last, ok := strings.Cut(spec, "-")
+        if !ok {
+            return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+        }
+        if first == "" {
+            // suffix-range: the final n bytes.
+            n, ok := parseRangeInt(last)
+            if !ok {
+                return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+            }
+            if n == 0 || size == 0 {
+                continue
+            }
+            n = min(n, size)
+            ranges = append(ranges, ByteRange{Start: size - n, Length: n})
+            continue
+        }
+        start, ok := parseRangeInt(first)
+        if !ok {
+            return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+        }
+        end := size - 1
+        if last != "" {
+            e, ok := parseRangeInt(last)
+            if !ok || e < start {
+                return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+            }
+            end = min(e, size-1)
+        }
+        if start >= size {
+            continue
+        }
+        ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+    }
+    if empty {
+        return nil, fmt.Errorf("%w: no ranges in %q", ErrInvalidRange, v)
+    }
+    if len(ranges) == 0 {
+        return nil, ErrUnsatisfiableRange
+    }
+    var total int64
+    for _, r := range ranges {
+        total += r.Length
+    }
+    if total > size {
+        return nil, fmt.Errorf("%w: ranges overlap", ErrInvalidRange)
+    }
+    return ranges, nil
+}
+
+// parseRangeInt parses a non-empty string of digits.
+func parseRangeInt(s string) (int64, bool) {
+    if s == "" {
+        return 0, false
+    }
+    for i := 0; i < len(s); i++ {
+        if s[i] < '0' || s[i] > '9' {
+            return 0, false
+        }
+    }
+    n, err := strconv.ParseInt(s, 10, 64)
+    return n, err == nil
+}
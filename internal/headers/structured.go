@@ -0,0 +1,616 @@
+package headers
+
+import (
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// ErrInvalidStructuredField is returned when a Structured Field Value
+// (RFC 8941) cannot be parsed or serialized.
+var ErrInvalidStructuredField = errors.New("invalid structured field")
+
+// Token is a Structured Field token, such as the "sha-256" in a digest
+// field. It is distinct from a String, which is quoted on the wire.
+type Token string
+
+// Item is a Structured Field Item: a bare value with parameters. Value is
+// one of int64 (Integer), float64 (Decimal), string (String), Token,
+// []byte (Byte Sequence) or bool (Boolean).
+type Item struct {
+    Value  interface{}
+    Params Params
+}
+
+// InnerList is a parenthesized list of Items with parameters of its own.
+type InnerList struct {
+    Items  []Item
+    Params Params
+}
+
+// Member is a member of a List or Dictionary: an Item or an InnerList.
+type Member interface {
+    isMember()
+}
+
+func (Item) isMember()      {}
+func (InnerList) isMember() {}
+
+// Param is a single parameter. Value holds the same types as Item.Value.
+type Param struct {
+    Key   string
+    Value interface{}
+}
+
+// Params is an ordered set of parameters.
+type Params []Param
+
+// Get returns the value of the parameter key.
+func (ps Params) Get(key string) (interface{}, bool) {
+    for _, p := range ps {
+        if p.Key == key {
+            return p.Value, true
+        }
+    }
+    return nil, false
+}
+
+// set overrides the parameter key in place or appends it.
+func (ps Params) set(key string, value interface{}) Params {
+    for i := range ps {
+        if ps[i].Key == key {
+            ps[i].Value = value
+            return ps
+        }
+    }
+    return append(ps, Param{Key: key, Value: value})
+}
+
+// List is a Structured Field List.
+type List []Member
+
+// DictMember is a single member of a Dictionary.
+type DictMember struct {
+    Key    string
+    Member Member
+}
+
+// Dictionary is an ordered map of keys to Members.
+type Dictionary []DictMember
+
+// Get returns the member for key.
+func (d Dictionary) Get(key string) (Member, bool) {
+    for _, m := range d {
+        if m.Key == key {
+            return m.Member, true
+        }
+    }
+    return nil, false
+}
+
+// ParseItem parses a field value as a Structured Field Item.
+func ParseItem(v string) (Item, error) {
+    p := sfParser{s: strings.Trim(v, " ")}
+    item, err := p.item()
+    if err != nil {
+        return Item{}, err
+    }
+    if !p.done() {
+        return Item{}, p.errorf("unexpected trailing characters")
+    }
+    return item, nil
+}
+
+// ParseList parses a field value as a Structured Field List. Several
+// field lines should be combined with Headers.Get before parsing.
+func ParseList(v string) (List, error) {
+    p := sfParser{s: strings.Trim(v, " ")}
+    var list List
+    for !p.done() {
+        m, err := p.member()
+        if err != nil {
+            return nil, err
+        }
+        list = append(list, m)
+        if err := p.nextMember(); err != nil {
+            return nil, err
+        }
+    }
+    return list, nil
+}
+
+// ParseDictionary parses a field value as a Structured Field Dictionary.
+// A repeated key overrides the earlier value and keeps its position.
+func ParseDictionary(v string) (Dictionary, error) {
+    p := sfParser{s: strings.Trim(v, " ")}
+    var dict Dictionary
+    for !p.done() {
+        key, err := p.key()
+        if err != nil {
+            return nil, err
+        }
+        var m Member
+        if p.peek() == '=' {
+            p.i++
+            if m, err = p.member(); err != nil {
+                return nil, err
+            }
+        } else {
+            params, err := p.params()
+            if err != nil {
+                return nil, err
+            }
+            m = Item{Value: true, Params: params}
+        }
+        dict = setDict(dict, key, m)
+        if err := p.nextMember(); err != nil {
+            return nil, err
+        }
+    }
+    return dict, nil
+}
+
+// setDict overrides key in place or appends it.
+func setDict(d Dictionary, key string, m Member) Dictionary {
+    for i := range d {
+        if d[i].Key == key {
+            d[i].Member = m
+            return d
+        }
+    }
+    return append(d, DictMember{Key: key, Member: m})
+}
+
+// sfParser holds the input and position of a Structured Field parse.
+type sfParser struct {
+    s string
+    i int
+}
+
+func (p *sfParser) done() bool { return p.i >= len(p.s) }
+
+// peek returns the next byte, or 0 at the end of input.
+func (p *sfParser) peek() byte {
+    if p.done() {
+        return 0
+    }
+    return p.s[p.i]
+}
+
+func (p *sfParser) errorf(format string, args ...interface{}) error {
+    return fmt.Errorf("%w: %s at offset %d", ErrInvalidStructuredField, fmt.Sprintf(format, args...), p.i)
+}
+
+// skip discards any of the bytes in set.
+func (p *sfParser) skip(set string) {
+    for !p.done() && strings.IndexByte(set, p.s[p.i]) != -1 {
+        p.i++
+    }
+}
+
+// nextMember consumes the separator after a List or Dictionary member.
+func (p *sfParser) nextMember() error {
+    p.skip(" \t")
+    if p.done() {
+        return nil
+    }
+    if p.s[p.i] != ',' {
+        return p.errorf("expected ','")
+    }
+    p.i++
+    p.skip(" \t")
+    if p.done() {
+        return p.errorf("trailing ','")
+    }
+    return nil
+}
+
+// member parses an Item or an InnerList.
+func (p *sfParser) member() (Member, error) {
+    if p.peek() == '(' {
+        return p.innerList()
+    }
+    return p.item()
+}
+
+func (p *sfParser) innerList() (InnerList, error) {
+    p.i++ // '('
+    var il InnerList
+    for !p.done() {
+        p.skip(" ")
+        if p.peek() == ')' {
+            p.i++
+            params, err := p.params()
+            if err != nil {
+                return InnerList{}, err
+            }
+            il.Params = params
+            return il, nil
+        }
+        item, err := p.item()
+        if err != nil {
+            return InnerList{}, err
+        }
+        il.Items = append(il.Items, item)
+        if c := p.peek(); c != ' ' && c != ')' {
+            return InnerList{}, p.errorf("expected ' ' or ')' in inner list")
+        }
+    }
+    return InnerList{}, p.errorf("unterminated inner list")
+}
+
+func (p *sfParser) item() (Item, error) {
+    v, err := p.bareItem()
+    if err != nil {
+        return Item{}, err
+    }
+    params, err := p.params()
+    if err != nil {
+        return Item{}, err
+    }
+    return Item{Value: v, Params: params}, nil
+}
+
+func (p *sfParser) params() (Params, error) {
+    var params Params
+    for p.peek() == ';' {
+        p.i++
+        p.skip(" ")
+        key, err := p.key()
+        if err != nil {
+            return nil, err
+        }
+        var v interface{} = true
+        if p.peek() == '=' {
+            p.i++
+            if v, err = p.bareItem(); err != nil {
+                return nil, err
+            }
+        }
+        params = params.set(key, v)
+    }
+    return params, nil
+}
+
+func (p *sfParser) key() (string, error) {
+    start := p.i
+    if c := p.peek(); !isLcAlpha(c) && c != '*' {
+        return "", p.errorf("invalid key")
+    }
+    for !p.done() && isKeyChar(p.s[p.i]) {
+        p.i++
+    }
+    return p.s[start:p.i], nil
+}
+
+func (p *sfParser) bareItem() (interface{}, error) {
+    switch c := p.peek(); {
+    case c == '-' || isDigit(c):
+        return p.number()
+    case c == '"':
+        return p.str()
+    case c == '*' || isAlpha(c):
+        return p.token(), nil
+    case c == ':':
+        return p.byteSeq()
+    case c == '?':
+        return p.boolean()
+    default:
+        return nil, p.errorf("unexpected character")
+    }
+}
+
+func (p *sfParser) number() (interface{}, error) {
+    start := p.i
+    if p.peek() == '-' {
+        p.i++
+    }
+    if !isDigit(p.peek()) {
+        return nil, p.errorf("expected digit")
+    }
+    digits := p.i
+    dot := -1
+    for !p.done() {
+        c := p.s[p.i]
+        if isDigit(c) {
+            p.i++
+        } else if c == '.' && dot == -1 {
+            if p.i-digits > 12 {
+                return nil, p.errorf("decimal integer part too long")
+            }
+            dot = p.i
+            p.i++
+        } else {
+            break
+        }
+        if dot == -1 && p.i-digits > 15 || dot != -1 && p.i-digits > 16 {
+            return nil, p.errorf("number too long")
+        }
+    }
+    num := p.s[start:p.i]
+    if dot == -1 {
+        n, err := strconv.ParseInt(num, 10, 64)
+        if err != nil {
+            return nil, p.errorf("invalid integer")
+        }
+        return n, nil
+    }
+    if frac := p.i - dot - 1; frac == 0 || frac > 3 {
+        return nil, p.errorf("decimal must have 1 to 3 fractional digits")
+    }
+    f, err := strconv.ParseFloat(num, 64)
+    if err != nil {
+        return nil, p.errorf("invalid decimal")
+    }
+    return f, nil
+}
+
+func (p *sfParser) str() (string, error) {
+    p.i++ // '"'
+    var b strings.Builder
+    for !p.done() {
+        c := p.s[p.i]
+        p.i++
+        switch {
+        case c == '\\':
+            if p.done() {
+                return "", p.errorf("unterminated escape")
+            }
+            next := p.s[p.i]
+            if next != '"' && next != '\\' {
+                return "", p.errorf("invalid escape")
+            }
+            p.i++
+            b.WriteByte(next)
+        case c == '"':
+            return b.String(), nil
+        case c < 0x20 || c > 0x7e:
+            return "", p.errorf("invalid character in string")
+        default:
+            b.WriteByte(c)
+        }
+    }
+    return "", p.errorf("unterminated string")
+}
+
+func (p *sfParser) token() Token {
+    start := p.i
+    p.i++
+    for !p.done() && isSFTokenChar(p.s[p.i]) {
+        p.i++
+    }
+    return Token(p.s[start:p.i])
+}
+
+func (p *sfParser) byteSeq() ([]byte, error) {
+    p.i++ // ':'
+    end := strings.IndexByte(p.s[p.i:], ':')
+    if end == -1 {
+        return nil, p.errorf("unterminated byte sequence")
+    }
+    enc := p.s[p.i : p.i+end]
+    for i := 0; i < len(enc); i++ {
+        if c := enc[i]; !isAlpha(c) && !isDigit(c) && c != '+' && c != '/' && c != '=' {
+            return nil, p.errorf("invalid character in byte sequence")
+        }
+    }
+    b, err := base64.StdEncoding.DecodeString(enc)
+    if err != nil {
+        // Padding is optional on input.
+        b, err = base64.RawStdEncoding.DecodeString(enc)
+        if err != nil {
+            return nil, p.errorf("invalid base64")
+        }
+    }
+    p.i += end + 1
+    if b == nil {
+        b = []byte{}
+    }
+    return b, nil
+}
+
+func (p *sfParser) boolean() (bool, error) {
+    p.i++ // '?'
+    switch p.peek() {
+    case '1':
+        p.i++
+        return true, nil
+    case '0':
+        p.i++
+        return false, nil
+    }
+    return false, p.errorf("invalid boolean")
+}
+
+// SerializeItem returns the field value for an Item.
+func SerializeItem(it Item) (string, error) {
+    var b strings.Builder
+    if err := writeItem(&b, it); err != nil {
+        return "", err
+    }
+    return b.String(), nil
+}
+
+// SerializeList returns the field value for a List.
+func SerializeList(l List) (string, error) {
+    var b strings.Builder
+    for i, m := range l {
+        if i > 0 {
+            b.WriteString(", ")
+        }
+        if err := writeMember(&b, m); err != nil {
+            return "", err
+        }
+    }
+    return b.String(), nil
+}
+
+// SerializeDictionary returns the field value for a Dictionary. A member
+// that is the Boolean true is written as its key and parameters only.
+func SerializeDictionary(d Dictionary) (string, error) {
+    var b strings.Builder
+    for i, dm := range d {
+        if i > 0 {
+            b.WriteString(", ")
+        }
+        if err := writeKey(&b, dm.Key); err != nil {
+            return "", err
+        }
+        if it, ok := dm.Member.(Item); ok && it.Value == true {
+            if err := writeParams(&b, it.Params); err != nil {
+                return "", err
+            }
+            continue
+        }
+        b.WriteByte('=')
+        if err := writeMember(&b, dm.Member); err != nil {
+            return "", err
+        }
+    }
+    return b.String(), nil
+}
+
+func writeMember(b *strings.Builder, m Member) error {
+    switch m := m.(type) {
+    case Item:
+        return writeItem(b, m)
+    case InnerList:
+        b.WriteByte('(')
+        for i, it := range m.Items {
+            if i > 0 {
+                b.WriteByte(' ')
+            }
+            if err := writeItem(b, it); err != nil {
+                return err
+            }
+        }
+        b.WriteByte(')')
+        return writeParams(b, m.Params)
+    default:
+        return fmt.Errorf("%w: unknown member type %T", ErrInvalidStructuredField, m)
+    }
+}
+
+func writeItem(b *strings.Builder, it Item) error {
+    if err := writeBareItem(b, it.Value); err != nil {
+        return err
+    }
+    return writeParams(b, it.Params)
+}
+
+func writeParams(b *strings.Builder, ps Params) error {
+    for _, p := range ps {
+        b.WriteByte(';')
+        if err := writeKey(b, p.Key); err != nil {
+            return err
+        }
+        if p.Value == true {
+            continue
+        }
+        b.WriteByte('=')
+        if err := writeBareItem(b, p.Value); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func writeKey(b *strings.Builder, key string) error {
+    if key == "" || !isLcAlpha(key[0]) && key[0] != '*' {
+        return fmt.Errorf("%w: invalid key %q", ErrInvalidStructuredField, key)
+    }
+    for i := 1; i < len(key); i++ {
+        if !isKeyChar(key[i]) {
+            return fmt.Errorf("%w: invalid key %q", ErrInvalidStructuredField, key)
+        }
+    }
+    b.WriteString(key)
+    return nil
+}
+
+func writeBareItem(b *strings.Builder, v interface{}) error {
+    switch v := v.(type) {
+    case int64:
+        return writeInteger(b, v)
+    case int:
+        return writeInteger(b, int64(v))
+    case float64:
+        return writeDecimal(b, v)
+    case string:
+        b.WriteByte('"')
+        for i := 0; i < len(v); i++ {
+            c := v[i]
+            if c < 0x20 || c > 0x7e {
+                return fmt.Errorf("%w: invalid character in string", ErrInvalidStructuredField)
+            }
+            if c == '"' || c == '\\' {
+                b.WriteByte('\\')
+            }
+            b.WriteByte(c)
+        }
+        b.WriteByte('"')
+    case Token:
+        if v == "" || v[0] != '*' && !isAlpha(v[0]) {
+            return fmt.Errorf("%w: invalid token %q", ErrInvalidStructuredField, string(v))
+        }
+        for i := 1; i < len(v); i++ {
+            if !isSFTokenChar(v[i]) {
+                return fmt.Errorf("%w: invalid token %q", ErrInvalidStructuredField, string(v))
+            }
+        }
+        b.WriteString(string(v))
+    case []byte:
+        b.WriteByte(':')
+        b.WriteString(base64.StdEncoding.EncodeToString(v))
+        b.WriteByte(':')
+    case bool:
+        if v {
+            b.WriteString("?1")
+        } else {
+            b.WriteString("?0")
+        }
+    default:
+        return fmt.Errorf("%w: unsupported value type %T", ErrInvalidStructuredField, v)
+    }
+    return nil
+}
+
+func writeInteger(b *strings.Builder, n int64) error {
+    if n < -999999999999999 || n > 999999999999999 {
+        return fmt.Errorf("%w: integer out of range", ErrInvalidStructuredField)
+    }
+    b.WriteString(strconv.FormatInt(n, 10))
+    return nil
+}
+
+// writeDecimal writes f rounded to three fractional digits, ties to even.
+func writeDecimal(b *strings.Builder, f float64) error {
+    r := math.RoundToEven(f*1000) / 1000
+    if math.IsNaN(r) || math.IsInf(r, 0) || math.Abs(r) >= 1e12 {
+        return fmt.Errorf("%w: decimal out of range", ErrInvalidStructuredField)
+    }
+    s := strconv.FormatFloat(r, 'f', -1, 64)
+    if !strings.Contains(s, ".") {
+        s += ".0"
+    }
+    b.WriteString(s)
+    return nil
+}
+
+func isDigit(c byte) bool   { return c >= '0' && c <= '9' }
+func isLcAlpha(c byte) bool { return c >= 'a' && c <= 'z' }
+func isAlpha(c byte) bool   { return isLcAlpha(c) || c >= 'A' && c <= 'Z' }
+
+// isKeyChar reports whether c may follow the first character of a key.
+func isKeyChar(c byte) bool {
+    return isLcAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// isSFTokenChar reports whether c may follow the first character of a
+// Structured Field token: a tchar, ':' or '/'.
+func isSFTokenChar(c byte) bool {
+    return isTokenChar(c) || c == ':' || c == '/'
+}
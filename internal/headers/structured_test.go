@@ -0,0 +1,257 @@
+package headers
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sfVector is one case in the format of the structured-field-tests suite.
+type sfVector struct {
+	Name       string          `json:"name"`
+	Raw        []string        `json:"raw"`
+	HeaderType string          `json:"header_type"`
+	Expected   json.RawMessage `json:"expected"`
+	MustFail   bool            `json:"must_fail"`
+	CanFail    bool            `json:"can_fail"`
+	Canonical  []string        `json:"canonical"`
+}
+
+// unsupportedSuites are the upstream files for RFC 9651 types this package
+// does not implement, with the reason they are skipped.
+var unsupportedSuites = map[string]string{
+	"date.json":           "Dates are not supported",
+	"display-string.json": "Display Strings are not supported",
+}
+
+func loadVectors(t *testing.T, pattern string) map[string][]sfVector {
+	files, err := filepath.Glob(pattern)
+	require.NoError(t, err)
+	out := make(map[string][]sfVector)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		require.NoError(t, err)
+		var vs []sfVector
+		require.NoError(t, json.Unmarshal(data, &vs), f)
+		out[filepath.Base(f)] = vs
+	}
+	return out
+}
+
+// Test: Parsing and serializing the httpwg structured-field-tests suite
+func Test_Structured_Field_Vectors(t *testing.T) {
+	parse := loadVectors(t, "testdata/structured-field-tests/*.json")
+	serialise := loadVectors(t, "testdata/structured-field-tests/serialisation-tests/*.json")
+	if len(parse) == 0 && len(serialise) == 0 {
+		t.Skip("upstream vectors not vendored; see testdata/structured-field-tests/README.md")
+	}
+	runParseVectors(t, parse)
+	runSerialisationVectors(t, serialise)
+}
+
+// Test: Parsing and serializing the hand-written vectors
+func Test_Structured_Field_Local_Vectors(t *testing.T) {
+	parse := loadVectors(t, "testdata/structured-fields/parse-*.json")
+	serialise := loadVectors(t, "testdata/structured-fields/serialise-*.json")
+	require.NotEmpty(t, parse)
+	require.NotEmpty(t, serialise)
+	runParseVectors(t, parse)
+	runSerialisationVectors(t, serialise)
+}
+
+// runParseVectors parses each vector's raw field and checks the result,
+// and that it serializes back to the canonical form.
+func runParseVectors(t *testing.T, suites map[string][]sfVector) {
+	for file, vectors := range suites {
+		for _, v := range vectors {
+			t.Run(file+"/"+v.Name, func(t *testing.T) {
+				if reason, ok := unsupportedSuites[file]; ok {
+					t.Skip(reason)
+				}
+				raw := strings.Join(v.Raw, ", ")
+				var got interface{}
+				var err error
+				switch v.HeaderType {
+				case "item":
+					got, err = ParseItem(raw)
+				case "list":
+					got, err = ParseList(raw)
+				case "dictionary":
+					got, err = ParseDictionary(raw)
+				default:
+					t.Fatalf("unknown header type %q", v.HeaderType)
+				}
+				if v.MustFail {
+					assert.ErrorIs(t, err, ErrInvalidStructuredField)
+					return
+				}
+				if err != nil && v.CanFail {
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, decodeExpected(t, v.HeaderType, v.Expected), got)
+
+				canonical := raw
+				if v.Canonical != nil {
+					canonical = strings.Join(v.Canonical, ", ")
+				}
+				assert.Equal(t, canonical, serialize(t, got))
+			})
+		}
+	}
+}
+
+// runSerialisationVectors serializes each vector's expected value.
+func runSerialisationVectors(t *testing.T, suites map[string][]sfVector) {
+	for file, vectors := range suites {
+		for _, v := range vectors {
+			t.Run("serialisation-tests/"+file+"/"+v.Name, func(t *testing.T) {
+				if reason, ok := unsupportedSuites[file]; ok {
+					t.Skip(reason)
+				}
+				value := decodeExpected(t, v.HeaderType, v.Expected)
+				var s string
+				var err error
+				switch value := value.(type) {
+				case Item:
+					s, err = SerializeItem(value)
+				case List:
+					s, err = SerializeList(value)
+				case Dictionary:
+					s, err = SerializeDictionary(value)
+				}
+				if v.MustFail {
+					assert.ErrorIs(t, err, ErrInvalidStructuredField)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, strings.Join(v.Canonical, ", "), s)
+			})
+		}
+	}
+}
+
+func serialize(t *testing.T, v interface{}) string {
+	var s string
+	var err error
+	switch v := v.(type) {
+	case Item:
+		s, err = SerializeItem(v)
+	case List:
+		s, err = SerializeList(v)
+	case Dictionary:
+		s, err = SerializeDictionary(v)
+	}
+	require.NoError(t, err)
+	return s
+}
+
+// decodeExpected converts the JSON form of the test suite into an Item,
+// List or Dictionary.
+func decodeExpected(t *testing.T, headerType string, raw json.RawMessage) interface{} {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	var v interface{}
+	require.NoError(t, dec.Decode(&v))
+	switch headerType {
+	case "item":
+		return decodeItem(t, v)
+	case "list":
+		var l List
+		for _, m := range v.([]interface{}) {
+			l = append(l, decodeMember(t, m))
+		}
+		return l
+	default:
+		var d Dictionary
+		for _, m := range v.([]interface{}) {
+			pair := m.([]interface{})
+			d = append(d, DictMember{Key: pair[0].(string), Member: decodeMember(t, pair[1])})
+		}
+		return d
+	}
+}
+
+func decodeMember(t *testing.T, v interface{}) Member {
+	pair := v.([]interface{})
+	if items, ok := pair[0].([]interface{}); ok {
+		var il InnerList
+		for _, it := range items {
+			il.Items = append(il.Items, decodeItem(t, it))
+		}
+		il.Params = decodeParams(t, pair[1])
+		return il
+	}
+	return decodeItem(t, v)
+}
+
+func decodeItem(t *testing.T, v interface{}) Item {
+	pair := v.([]interface{})
+	return Item{Value: decodeBare(t, pair[0]), Params: decodeParams(t, pair[1])}
+}
+
+func decodeParams(t *testing.T, v interface{}) Params {
+	var ps Params
+	for _, p := range v.([]interface{}) {
+		pair := p.([]interface{})
+		ps = append(ps, Param{Key: pair[0].(string), Value: decodeBare(t, pair[1])})
+	}
+	return ps
+}
+
+func decodeBare(t *testing.T, v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			f, err := v.Float64()
+			require.NoError(t, err)
+			return f
+		}
+		n, err := v.Int64()
+		require.NoError(t, err)
+		return n
+	case map[string]interface{}:
+		switch v["__type"] {
+		case "token":
+			return Token(v["value"].(string))
+		case "binary":
+			b, err := base32.StdEncoding.DecodeString(v["value"].(string))
+			require.NoError(t, err)
+			return b
+		}
+		t.Fatalf("unsupported type %v", v["__type"])
+	}
+	return v
+}
+
+// Test: Building and reading a structured field by hand
+func Test_Structured_Field_Values(t *testing.T) {
+	d, err := ParseDictionary(`sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:, u=3, i`)
+	require.NoError(t, err)
+	m, ok := d.Get("u")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), m.(Item).Value)
+	m, ok = d.Get("i")
+	require.True(t, ok)
+	assert.Equal(t, true, m.(Item).Value)
+	_, ok = d.Get("missing")
+	assert.False(t, ok)
+
+	s, err := SerializeList(List{
+		Item{Value: Token("hit"), Params: Params{{Key: "ttl", Value: 376}, {Key: "detail", Value: "a b"}}},
+		InnerList{Items: []Item{{Value: []byte("hi")}, {Value: false}}, Params: Params{{Key: "x", Value: 0.1}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `hit;ttl=376;detail="a b", (:aGk=: ?0);x=0.1`, s)
+
+	_, err = SerializeItem(Item{Value: uint8(1)})
+	assert.ErrorIs(t, err, ErrInvalidStructuredField)
+	_, err = SerializeItem(Item{Value: "caf\xe9"})
+	assert.ErrorIs(t, err, ErrInvalidStructuredField)
+}
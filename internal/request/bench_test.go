@@ -0,0 +1,67 @@
+package request
+
+import (
+    "bytes"
+    "io"
+    "strings"
+    "testing"
+)
+
+// benchRequest is a typical browser request head.
+const benchRequest = "GET /articles/2024/http-parsing?page=2&sort=new HTTP/1.1\r\n" +
+    "Host: www.example.com\r\n" +
+    "User-Agent: Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0\r\n" +
+    "Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\n" +
+    "Accept-Language: en-US,en;q=0.5\r\n" +
+    "Accept-Encoding: gzip, deflate, br, zstd\r\n" +
+    "Connection: keep-alive\r\n" +
+    "Cookie: session=8f14e45fceea167a5a36dedd4bea2543; theme=dark\r\n" +
+    "Upgrade-Insecure-Requests: 1\r\n" +
+    "Sec-Fetch-Dest: document\r\n" +
+    "Sec-Fetch-Mode: navigate\r\n" +
+    "Sec-Fetch-Site: none\r\n" +
+    "Priority: u=0, i\r\n" +
+    "\r\n"
+
+func BenchmarkRequestHead(b *testing.B) {
+    b.ReportAllocs()
+    b.SetBytes(int64(len(benchRequest)))
+    for i := 0; i < b.N; i++ {
+        if _, err := RequestHeadFromReader(strings.NewReader(benchRequest)); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+// BenchmarkRequestHeadSmallReads feeds the request a few bytes at a time,
+// as a slow client would.
+func BenchmarkRequestHeadSmallReads(b *testing.B) {
+    b.ReportAllocs()
+    b.SetBytes(int64(len(benchRequest)))
+    for i := 0; i < b.N; i++ {
+        r := &chunkReader{data: benchRequest, numBytesPerRead: 16}
+        if _, err := RequestHeadFromReader(r); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+// BenchmarkReaderPipelined parses many requests from one connection.
+func BenchmarkReaderPipelined(b *testing.B) {
+    const perConn = 100
+    data := []byte(strings.Repeat(benchRequest, perConn))
+    b.ReportAllocs()
+    b.SetBytes(int64(len(data)))
+    for i := 0; i < b.N; i++ {
+        rd := NewReader(bytes.NewReader(data))
+        for {
+            _, err := rd.ReadRequest()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                b.Fatal(err)
+            }
+        }
+    }
+}
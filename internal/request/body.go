@@ -0,0 +1,446 @@
+package request
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+// source buffers bytes read from the underlying reader that have not yet
+// been consumed by the parser. buf is a window into store; reads go
+// straight into the free space after it, so the bytes are copied only when
+// the window has to move to the front of store or grow.
+type source struct {
+    r     io.Reader
+    buf   []byte
+    store []byte
+    err   error
+}
+
+// Sizes of the source buffer: its initial size, and the least free space
+// offered to each read.
+const (
+    sourceBufSize = 4096
+    minReadSize   = 512
+)
+
+func newSource(r io.Reader) *source {
+    store := make([]byte, sourceBufSize)
+    return &source{r: r, buf: store[:0], store: store}
+}
+
+// fill reads once from the underlying reader and appends the bytes to buf.
+// A read error is returned only once no new bytes came with it; it is
+// then returned again on every later call.
+func (s *source) fill() error {
+    if s.err != nil {
+        return s.err
+    }
+    if cap(s.buf)-len(s.buf) < minReadSize {
+        s.makeRoom()
+    }
+    n, err := s.r.Read(s.buf[len(s.buf):cap(s.buf)])
+    s.buf = s.buf[:len(s.buf)+n]
+    if err != nil {
+        s.err = err
+        if n > 0 {
+            return nil
+        }
+        return err
+    }
+    return nil
+}
+
+// makeRoom moves the unconsumed bytes to the front of store, growing it
+// when they fill more than half of it.
+func (s *source) makeRoom() {
+    if len(s.buf) > len(s.store)/2 {
+        s.store = make([]byte, 2*len(s.store))
+    }
+    n := copy(s.store, s.buf)
+    s.buf = s.store[:n]
+}
+
+// startBody chooses the body framing from the parsed headers, following
+// RFC 9112 section 6.3 so that the message length cannot be read
+// differently by another server on the path.
+func (r *Request) startBody() error {
+    te := r.Headers.Values("Transfer-Encoding")
+    cl := r.Headers.Values("Content-Length")
+    if len(te) > 0 {
+        // HTTP/1.0 does not define Transfer-Encoding; its framing is faulty.
+        if !r.ProtoAtLeast(1, 1) {
+            return fmt.Errorf("%w: not allowed in HTTP/1.0", ErrInvalidTransferEncoding)
+        }
+        if err := checkTransferCodings(te); err != nil {
+            return err
+        }
+        if len(cl) > 0 {
+            // Transfer-Encoding overrides Content-Length, but a message with
+            // both may be framed differently elsewhere: never reuse the
+            // connection after it.
+            r.Headers.Del("Content-Length")
+            r.ambiguousFraming = true
+        }
+        r.state = stateParsingChunkSize
+        r.hasBody = true
+        return nil
+    }
+    // Determine desired content length from headers; if missing, there is no body.
+    if len(cl) == 0 {
+        r.state = stateDone
+        return nil
+    }
+    want, err := parseContentLength(cl)
+    if err != nil {
+        return err
+    }
+    if exceeds(want, r.limits.MaxBodyBytes) {
+        return ErrBodyTooLarge
+    }
+    if want == 0 {
+        r.state = stateDone
+        return nil
+    }
+    r.bodyLeft = want
+    r.hasBody = true
+    r.state = stateParsingFixedBody
+    return nil
+}
+
+// checkTransferCodings validates the Transfer-Encoding field lines of a
+// request. Only chunked is implemented; it must be the final coding and
+// appear once. Any other coding is unsupported.
+func checkTransferCodings(values []string) error {
+    var codings []string
+    for _, v := range values {
+        for _, c := range strings.Split(v, ",") {
+            c = strings.Trim(c, " \t")
+            if c == "" {
+                return fmt.Errorf("%w: empty transfer coding", ErrInvalidTransferEncoding)
+            }
+            codings = append(codings, c)
+        }
+    }
+    for i, c := range codings {
+        if !strings.EqualFold(c, "chunked") {
+            if strings.ContainsAny(c, "; \t=") {
+                return fmt.Errorf("%w: malformed transfer coding %q", ErrInvalidTransferEncoding, c)
+            }
+            return fmt.Errorf("%w: %q", ErrUnsupportedTransferCoding, c)
+        }
+        if i != len(codings)-1 {
+            return fmt.Errorf("%w: chunked must be the final coding, applied once", ErrInvalidTransferEncoding)
+        }
+    }
+    return nil
+}
+
+// parseContentLength parses the Content-Length field lines. A list of
+// identical values, such as "5, 5" or two lines of "5", is accepted as a
+// single value; differing values are rejected.
+func parseContentLength(values []string) (int, error) {
+    length := -1
+    for _, v := range values {
+        for _, part := range strings.Split(v, ",") {
+            part = strings.Trim(part, " \t")
+            if part == "" || len(part) > maxContentLengthDigits {
+                return 0, ErrInvalidContentLength
+            }
+            n := 0
+            for i := 0; i < len(part); i++ {
+                c := part[i]
+                if c < '0' || c > '9' {
+                    return 0, ErrInvalidContentLength
+                }
+                n = n*10 + int(c-'0')
+            }
+            if length != -1 && n != length {
+                return 0, fmt.Errorf("%w: %d and %d", ErrConflictingLength, length, n)
+            }
+            length = n
+        }
+    }
+    return length, nil
+}
+
+// maxChunkLineBytes bounds a chunk-size line including its extensions.
+const maxChunkLineBytes = 4096
+
+// maxContentLengthDigits bounds Content-Length so it cannot overflow an int.
+const maxContentLengthDigits = 18
+
+// parseBodySingle processes a single step of body decoding. It returns the
+// number of bytes consumed from data and, if the step produced body bytes,
+// those bytes as a sub-slice of data holding at most max bytes.
+func (r *Request) parseBodySingle(data []byte, max int) (int, []byte, error) {
+    switch r.state {
+    case stateParsingFixedBody:
+        n := min(len(data), r.bodyLeft, max)
+        r.bodyLeft -= n
+        r.bodyRead += n
+        if r.bodyLeft == 0 {
+            r.state = stateDone
+        }
+        return n, data[:n], nil
+    case stateParsingChunkSize:
+        lf := bytes.IndexByte(data, '\n')
+        if lf == -1 {
+            if len(data) > maxChunkLineBytes {
+                return 0, nil, fmt.Errorf("%w: size line too long", ErrInvalidChunk)
+            }
+            return 0, nil, nil
+        }
+        if lf == 0 || data[lf-1] != '\r' {
+            return 0, nil, fmt.Errorf("%w: size line must end with CRLF", ErrInvalidChunk)
+        }
+        size, err := parseChunkSize(data[:lf-1])
+        if err != nil {
+            return 0, nil, err
+        }
+        if exceeds(r.bodyRead+size, r.limits.MaxBodyBytes) {
+            return 0, nil, ErrBodyTooLarge
+        }
+        if size == 0 {
+            // Last chunk; trailer section follows.
+            r.Trailers = headers.NewHeaders()
+            r.fields = headers.Parser{Mode: r.fields.Mode}
+            r.state = stateParsingTrailers
+        } else {
+            r.bodyLeft = size
+            r.state = stateParsingChunkData
+        }
+        return lf + 1, nil, nil
+    case stateParsingChunkData:
+        n := min(len(data), r.bodyLeft, max)
+        r.bodyLeft -= n
+        r.bodyRead += n
+        if r.bodyLeft == 0 {
+            r.state = stateParsingChunkDataEnd
+        }
+        return n, data[:n], nil
+    case stateParsingChunkDataEnd:
+        if len(data) < 2 {
+            return 0, nil, nil
+        }
+        if data[0] != '\r' || data[1] != '\n' {
+            return 0, nil, fmt.Errorf("%w: missing CRLF after chunk data", ErrInvalidChunk)
+        }
+        r.state = stateParsingChunkSize
+        return 2, nil, nil
+    case stateParsingTrailers:
+        n, done, err := r.parseField(r.Trailers, data)
+        if err != nil {
+            return 0, nil, err
+        }
+        if done {
+            r.state = stateDone
+        }
+        return n, nil, nil
+    case stateDone:
+        return 0, nil, nil
+    default:
+        return 0, nil, errors.New("invalid parser state")
+    }
+}
+
+// bodyReader decodes the body of req from the bytes buffered in src.
+type bodyReader struct {
+    req    *Request
+    src    *source
+    err    error
+    closed bool
+    // onRead is called once before the first byte of the body is read.
+    onRead func() error
+}
+
+// Read reads decoded body bytes into p. It returns io.EOF once the whole
+// body has been read and io.ErrUnexpectedEOF if the connection ends early.
+func (b *bodyReader) Read(p []byte) (int, error) {
+    if b.closed {
+        return 0, errors.New("read on closed body")
+    }
+    if b.err != nil {
+        return 0, b.err
+    }
+    if len(p) == 0 {
+        return 0, nil
+    }
+    if b.onRead != nil && b.req.state != stateDone {
+        fn := b.onRead
+        b.onRead = nil
+        if err := fn(); err != nil {
+            b.err = err
+            return 0, err
+        }
+    }
+    for {
+        if b.req.state == stateDone {
+            return 0, io.EOF
+        }
+        before := b.req.state
+        consumed, out, err := b.req.parseBodySingle(b.src.buf, len(p))
+        if err != nil {
+            b.err = b.req.wrapError(err)
+            return 0, b.err
+        }
+        n := copy(p, out)
+        b.src.buf = b.src.buf[consumed:]
+        b.req.offset += consumed
+        if n > 0 {
+            return n, nil
+        }
+        if consumed > 0 || b.req.state != before {
+            continue
+        }
+        // Need more data
+        if err := b.src.fill(); err != nil {
+            if err == io.EOF {
+                err = io.ErrUnexpectedEOF
+            }
+            b.err = err
+            return 0, err
+        }
+    }
+}
+
+// drain discards the rest of the body so the connection is positioned at
+// the start of the next request. It works even after Close.
+func (b *bodyReader) drain() error {
+    if b.err != nil {
+        return b.err
+    }
+    // The client is not waiting for permission to send what is discarded.
+    b.onRead = nil
+    closed := b.closed
+    b.closed = false
+    _, err := io.Copy(io.Discard, b)
+    b.closed = closed
+    return err
+}
+
+// Close marks the body as closed. Further reads fail.
+func (b *bodyReader) Close() error {
+    b.closed = true
+    return nil
+}
+
+// maxChunkSizeDigits bounds the significant hex digits of a chunk size so
+// it cannot overflow an int. Leading zeros do not count.
+const maxChunkSizeDigits = 15
+
+// parseChunkSize parses a chunk-size line without its CRLF:
+//   chunk-size [ chunk-ext ]
+// Chunk extensions are validated and then ignored.
+func parseChunkSize(line []byte) (int, error) {
+    sizePart := line
+    var ext []byte
+    if semi := bytes.IndexByte(line, ';'); semi != -1 {
+        sizePart = line[:semi]
+        ext = line[semi:]
+    }
+    // BWS is allowed between the size and the first extension.
+    sizePart = bytes.TrimRight(sizePart, " \t")
+    if len(sizePart) == 0 {
+        return 0, fmt.Errorf("%w: empty size", ErrInvalidChunk)
+    }
+    if len(bytes.TrimLeft(sizePart, "0")) > maxChunkSizeDigits {
+        return 0, fmt.Errorf("%w: size too large", ErrInvalidChunk)
+    }
+    size := 0
+    for _, c := range sizePart {
+        var d byte
+        switch {
+        case c >= '0' && c <= '9':
+            d = c - '0'
+        case c >= 'a' && c <= 'f':
+            d = c - 'a' + 10
+        case c >= 'A' && c <= 'F':
+            d = c - 'A' + 10
+        default:
+            return 0, fmt.Errorf("%w: size not hex", ErrInvalidChunk)
+        }
+        size = size<<4 | int(d)
+    }
+    if err := validateChunkExt(ext); err != nil {
+        return 0, err
+    }
+    return size, nil
+}
+
+// validateChunkExt checks the syntax of zero or more chunk extensions:
+//   chunk-ext = *( BWS ";" BWS ext-name [ BWS "=" BWS ext-val ] )
+func validateChunkExt(ext []byte) error {
+    i := 0
+    skipBWS := func() {
+        for i < len(ext) && (ext[i] == ' ' || ext[i] == '\t') {
+            i++
+        }
+    }
+    for {
+        skipBWS()
+        if i == len(ext) {
+            return nil
+        }
+        if ext[i] != ';' {
+            return fmt.Errorf("%w: malformed extension", ErrInvalidChunk)
+        }
+        i++
+        skipBWS()
+        start := i
+        for i < len(ext) && isTokenChar(ext[i]) {
+            i++
+        }
+        if i == start {
+            return fmt.Errorf("%w: empty extension name", ErrInvalidChunk)
+        }
+        skipBWS()
+        if i == len(ext) || ext[i] != '=' {
+            continue
+        }
+        i++
+        skipBWS()
+        if i < len(ext) && ext[i] == '"' {
+            // quoted-string with backslash escapes
+            i++
+            for {
+                if i == len(ext) {
+                    return fmt.Errorf("%w: unterminated quoted string in extension", ErrInvalidChunk)
+                }
+                c := ext[i]
+                if c == '"' {
+                    i++
+                    break
+                }
+                if c == '\\' {
+                    i++
+                    if i == len(ext) {
+                        return fmt.Errorf("%w: unterminated quoted string in extension", ErrInvalidChunk)
+                    }
+                }
+                i++
+            }
+            continue
+        }
+        start = i
+        for i < len(ext) && isTokenChar(ext[i]) {
+            i++
+        }
+        if i == start {
+            return fmt.Errorf("%w: empty extension value", ErrInvalidChunk)
+        }
+    }
+}
+
+// isTokenChar reports whether c is a tchar as defined by RFC 9110.
+func isTokenChar(c byte) bool {
+    switch {
+    case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+        return true
+    }
+    return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
@@ -0,0 +1,132 @@
+package request
+
+import (
+    "errors"
+    "fmt"
+)
+
+var (
+    // ErrInvalidRequestLine is returned for a malformed request-line.
+    ErrInvalidRequestLine = errors.New("invalid request line")
+    // ErrInvalidMethod is returned when the method is not a valid token.
+    ErrInvalidMethod = errors.New("invalid method")
+    // ErrInvalidTarget is returned when the request-target cannot be parsed.
+    ErrInvalidTarget = errors.New("invalid request target")
+    // ErrInvalidQuery is returned for a malformed query string.
+    ErrInvalidQuery = errors.New("invalid query")
+    // ErrInvalidForm is returned for a malformed urlencoded form body.
+    ErrInvalidForm = errors.New("invalid form")
+    // ErrBodyPartlyRead is returned by Form when part of the body was read
+    // through BodyReader and is no longer available.
+    ErrBodyPartlyRead = errors.New("request body was partly read")
+    // ErrNotMultipart is returned when the request is not multipart/form-data.
+    ErrNotMultipart = errors.New("request Content-Type is not multipart/form-data")
+    // ErrInvalidMultipart is returned for a malformed multipart body.
+    ErrInvalidMultipart = errors.New("invalid multipart body")
+    // ErrInvalidVersion is returned when the HTTP-version is malformed.
+    ErrInvalidVersion = errors.New("invalid http version format")
+    // ErrUnsupportedVersion is returned for a well-formed but unsupported version.
+    ErrUnsupportedVersion = errors.New("unsupported http version")
+    // ErrIncompleteRequest is returned when the connection ends inside a request head.
+    ErrIncompleteRequest = errors.New("incomplete request")
+    // ErrInvalidContentLength is returned for a malformed Content-Length.
+    ErrInvalidContentLength = errors.New("invalid Content-Length")
+    // ErrConflictingLength is returned when Content-Length values differ.
+    ErrConflictingLength = errors.New("conflicting Content-Length values")
+    // ErrInvalidTransferEncoding is returned for a Transfer-Encoding that
+    // cannot frame a request, such as chunked not being the final coding.
+    ErrInvalidTransferEncoding = errors.New("invalid Transfer-Encoding")
+    // ErrUnsupportedTransferCoding is returned for a transfer coding other
+    // than chunked.
+    ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+    // ErrInvalidChunk is returned for malformed chunked framing.
+    ErrInvalidChunk = errors.New("invalid chunk")
+    // ErrUnreadBody is returned by Reader.ReadRequest when the unread body
+    // of the previous request could not be skipped. That request has
+    // already been answered, so the connection should be closed without
+    // another response.
+    ErrUnreadBody = errors.New("previous request body could not be skipped")
+)
+
+// ErrorCategory identifies the part of the request a ParseError came from.
+type ErrorCategory int
+
+const (
+    CategoryRequestLine ErrorCategory = iota + 1
+    CategoryHeaders
+    CategoryBody
+    CategoryTrailers
+)
+
+// String returns a short lowercase name for the category.
+func (c ErrorCategory) String() string {
+    switch c {
+    case CategoryRequestLine:
+        return "request-line"
+    case CategoryHeaders:
+        return "headers"
+    case CategoryBody:
+        return "body"
+    case CategoryTrailers:
+        return "trailers"
+    default:
+        return "unknown"
+    }
+}
+
+// ParseError describes why a request could not be parsed. Err holds the
+// underlying sentinel error, so callers can match with errors.Is and
+// inspect the details with errors.As.
+type ParseError struct {
+    Category ErrorCategory
+    // Offset is the byte offset from the start of the request of the line
+    // or element where the problem was found.
+    Offset int
+    // StatusCode is the response status code suggested for the error.
+    StatusCode int
+    // Version is the HTTP version of the request-line, or "" if the error
+    // was found before it was parsed.
+    Version string
+    Err     error
+}
+
+func (e *ParseError) Error() string {
+    return fmt.Sprintf("%s at byte %d", e.Err, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// statusForError suggests the response status code for a parse error.
+func statusForError(err error) int {
+    switch {
+    case errors.Is(err, ErrRequestLineTooLong):
+        return 414
+    case errors.Is(err, ErrHeaderTooLarge):
+        return 431
+    case errors.Is(err, ErrBodyTooLarge):
+        return 413
+    case errors.Is(err, ErrUnsupportedVersion):
+        return 505
+    case errors.Is(err, ErrUnsupportedTransferCoding):
+        return 501
+    default:
+        return 400
+    }
+}
+
+// wrapError turns a parse failure into a *ParseError positioned at the
+// current parser state.
+func (r *Request) wrapError(err error) *ParseError {
+    var cat ErrorCategory
+    switch r.state {
+    case stateInitialized:
+        cat = CategoryRequestLine
+    case stateParsingHeaders:
+        cat = CategoryHeaders
+    case stateParsingTrailers:
+        cat = CategoryTrailers
+    default:
+        cat = CategoryBody
+    }
+    return &ParseError{Category: cat, Offset: r.offset, StatusCode: statusForError(err), Version: r.RequestLine.HttpVersion, Err: err}
+}
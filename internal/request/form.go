@@ -0,0 +1,120 @@
+package request
+
+import (
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Values maps a query or form parameter name to its values, in the order
+// they appeared.
+type Values map[string][]string
+
+// Get returns the first value for key, or "" if there is none.
+func (v Values) Get(key string) string {
+    if vs := v[key]; len(vs) > 0 {
+        return vs[0]
+    }
+    return ""
+}
+
+// Has reports whether key is present, even with an empty value.
+func (v Values) Has(key string) bool {
+    _, ok := v[key]
+    return ok
+}
+
+// ParseQuery parses an application/x-www-form-urlencoded string such as a
+// query, decoding percent-escapes and '+' as a space. At most maxFields
+// parameters are accepted; a non-positive maxFields means no limit.
+func ParseQuery(s string, maxFields int) (Values, error) {
+    return parseValues(s, maxFields, ErrInvalidQuery)
+}
+
+// parseValues parses "name=value&name=value" pairs, reporting syntax
+// errors wrapped in kind.
+func parseValues(s string, maxFields int, kind error) (Values, error) {
+    v := make(Values)
+    fields := 0
+    for s != "" {
+        var pair string
+        pair, s, _ = strings.Cut(s, "&")
+        if pair == "" {
+            continue
+        }
+        fields++
+        if exceeds(fields, maxFields) {
+            return nil, fmt.Errorf("%w: more than %d fields", ErrFormTooLarge, maxFields)
+        }
+        rawKey, rawVal, _ := strings.Cut(pair, "=")
+        key, err := unescape(rawKey, true)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v in name %q", kind, err, rawKey)
+        }
+        val, err := unescape(rawVal, true)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v in value of %q", kind, err, key)
+        }
+        v[key] = append(v[key], val)
+    }
+    return v, nil
+}
+
+// Query parses the query string of the request-target. The result is
+// cached, so repeated calls are cheap.
+func (r *Request) Query() (Values, error) {
+    if r.query == nil && r.queryErr == nil {
+        r.query, r.queryErr = ParseQuery(r.RequestLine.URL.RawQuery, r.limitsOrDefault().MaxFormFields)
+    }
+    return r.query, r.queryErr
+}
+
+// Form parses an application/x-www-form-urlencoded body. It reads the body
+// on first use, at most Limits.MaxFormBytes of it, and stores it in Body.
+// A body already in Body is subject to the same limit, and a body partly
+// read through BodyReader yields ErrBodyPartlyRead.
+// Requests with any other Content-Type yield empty Values. The result is
+// cached, so repeated calls are cheap.
+func (r *Request) Form() (Values, error) {
+    if !r.formDone {
+        r.formDone = true
+        r.form, r.formErr = r.parseForm()
+    }
+    return r.form, r.formErr
+}
+
+func (r *Request) parseForm() (Values, error) {
+    mediaType, _, _ := strings.Cut(r.Headers.Get("Content-Type"), ";")
+    if !strings.EqualFold(strings.TrimSpace(mediaType), "application/x-www-form-urlencoded") {
+        return Values{}, nil
+    }
+    limits := r.limitsOrDefault()
+    // Body only holds what was read through ReadBody (or Form); bytes a
+    // handler took from BodyReader itself are gone.
+    if r.bodyRead > len(r.Body) {
+        return nil, ErrBodyPartlyRead
+    }
+    body := r.Body
+    if r.BodyReader != nil && r.state != stateDone {
+        var src io.Reader = r.BodyReader
+        if limits.MaxFormBytes > 0 {
+            src = io.LimitReader(src, int64(limits.MaxFormBytes-len(body))+1)
+        }
+        data, err := io.ReadAll(src)
+        if err != nil {
+            return nil, err
+        }
+        body = append(body, data...)
+    }
+    if exceeds(len(body), limits.MaxFormBytes) {
+        return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrFormTooLarge, limits.MaxFormBytes)
+    }
+    r.Body = body
+    return parseValues(string(body), limits.MaxFormFields, ErrInvalidForm)
+}
+
+// limitsOrDefault returns the limits the request was parsed with, or the
+// defaults for a Request built by hand.
+func (r *Request) limitsOrDefault() Limits {
+    return r.limits.withDefaults()
+}
@@ -0,0 +1,94 @@
+package request
+
+import "errors"
+
+// Limits bounds how much a client may send in a single request.
+// A zero field means the value from DefaultLimits is used; a negative
+// field disables that limit.
+type Limits struct {
+    // MaxRequestLineBytes is the longest request-line accepted, excluding CRLF.
+    MaxRequestLineBytes int
+    // MaxHeaderBytes is the total size of the header section, and of the
+    // trailer section of a chunked body, including line endings.
+    MaxHeaderBytes int
+    // MaxHeaderCount is the number of header (and trailer) lines accepted.
+    MaxHeaderCount int
+    // MaxBodyBytes is the largest decoded body accepted.
+    MaxBodyBytes int
+    // MaxFormBytes is the largest urlencoded form body read by Request.Form.
+    MaxFormBytes int
+    // MaxFormFields is the number of parameters accepted in a query string
+    // or urlencoded form.
+    MaxFormFields int
+    // MaxPartBytes is the largest content of a single multipart part.
+    MaxPartBytes int
+    // MaxMultipartBytes is the largest encoded multipart body read by a
+    // MultipartReader.
+    MaxMultipartBytes int
+}
+
+// DefaultLimits are the limits applied when none are configured.
+var DefaultLimits = Limits{
+    MaxRequestLineBytes: 8 << 10,
+    MaxHeaderBytes:      64 << 10,
+    MaxHeaderCount:      100,
+    MaxBodyBytes:        10 << 20,
+    MaxFormBytes:        1 << 20,
+    MaxFormFields:       1000,
+    MaxPartBytes:        10 << 20,
+    MaxMultipartBytes:   32 << 20,
+}
+
+var (
+    // ErrRequestLineTooLong is returned when the request-line exceeds
+    // Limits.MaxRequestLineBytes.
+    ErrRequestLineTooLong = errors.New("request line too long")
+    // ErrHeaderTooLarge is returned when the header section exceeds
+    // Limits.MaxHeaderBytes or Limits.MaxHeaderCount.
+    ErrHeaderTooLarge = errors.New("request header fields too large")
+    // ErrBodyTooLarge is returned when the body exceeds Limits.MaxBodyBytes.
+    ErrBodyTooLarge = errors.New("request body too large")
+    // ErrFormTooLarge is returned when a urlencoded form exceeds
+    // Limits.MaxFormBytes or Limits.MaxFormFields.
+    ErrFormTooLarge = errors.New("form too large")
+    // ErrPartTooLarge is returned when a multipart part exceeds
+    // Limits.MaxPartBytes.
+    ErrPartTooLarge = errors.New("multipart part too large")
+    // ErrMultipartTooLarge is returned when a multipart body exceeds
+    // Limits.MaxMultipartBytes.
+    ErrMultipartTooLarge = errors.New("multipart body too large")
+)
+
+// withDefaults fills zero fields from DefaultLimits.
+func (l Limits) withDefaults() Limits {
+    if l.MaxRequestLineBytes == 0 {
+        l.MaxRequestLineBytes = DefaultLimits.MaxRequestLineBytes
+    }
+    if l.MaxHeaderBytes == 0 {
+        l.MaxHeaderBytes = DefaultLimits.MaxHeaderBytes
+    }
+    if l.MaxHeaderCount == 0 {
+        l.MaxHeaderCount = DefaultLimits.MaxHeaderCount
+    }
+    if l.MaxBodyBytes == 0 {
+        l.MaxBodyBytes = DefaultLimits.MaxBodyBytes
+    }
+    if l.MaxFormBytes == 0 {
+        l.MaxFormBytes = DefaultLimits.MaxFormBytes
+    }
+    if l.MaxFormFields == 0 {
+        l.MaxFormFields = DefaultLimits.MaxFormFields
+    }
+    if l.MaxPartBytes == 0 {
+        l.MaxPartBytes = DefaultLimits.MaxPartBytes
+    }
+    if l.MaxMultipartBytes == 0 {
+        l.MaxMultipartBytes = DefaultLimits.MaxMultipartBytes
+    }
+    return l
+}
+
+// exceeds reports whether n is over limit. Negative limits never trigger.
+func exceeds(n, limit int) bool {
+    return limit > 0 && n > limit
+}
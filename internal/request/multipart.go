@@ -0,0 +1,354 @@
+package request
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "path"
+    "strings"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+// MultipartReader reads the parts of a multipart/form-data body one at a
+// time. Part contents are streamed, so large uploads are never held in
+// memory as a whole.
+type MultipartReader struct {
+    src    io.Reader
+    buf    []byte
+    tmp    []byte
+    srcErr error
+    // dashBoundary is "--" + boundary; delim is CRLF + dashBoundary.
+    dashBoundary []byte
+    delim        []byte
+    limits       Limits
+    // HeaderMode selects how part header lines are validated. The zero
+    // value is headers.Strict; Request.MultipartReader uses the mode the
+    // request headers were parsed with.
+    HeaderMode headers.Mode
+    // total is the number of encoded bytes read from src.
+    total int
+    cur   *Part
+    done  bool
+    err   error
+}
+
+// Part is one part of a multipart body. Read returns its content.
+type Part struct {
+    Headers  *headers.Headers
+    mr       *MultipartReader
+    read     int
+    done     bool
+    formName string
+    fileName string
+}
+
+// MultipartReader returns a reader over the parts of a multipart/form-data
+// request body. The boundary comes from the Content-Type header.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+    mediaType, params, err := headers.ParseMediaType(r.Headers.Get("Content-Type"))
+    if err != nil || mediaType != "multipart/form-data" {
+        return nil, ErrNotMultipart
+    }
+    var body io.Reader = r.BodyReader
+    if r.BodyReader == nil || r.state == stateDone && r.Body != nil {
+        body = bytes.NewReader(r.Body)
+    }
+    mr, err := NewMultipartReader(body, params["boundary"], r.limitsOrDefault())
+    if err != nil {
+        return nil, err
+    }
+    mr.HeaderMode = r.fields.Mode
+    return mr, nil
+}
+
+// NewMultipartReader returns a reader over the parts of body, which are
+// separated by boundary. Part headers are bounded by limits.MaxHeaderBytes
+// and limits.MaxHeaderCount; part and total sizes by limits.MaxPartBytes
+// and limits.MaxMultipartBytes.
+func NewMultipartReader(body io.Reader, boundary string, limits Limits) (*MultipartReader, error) {
+    if err := validateBoundary(boundary); err != nil {
+        return nil, err
+    }
+    mr := &MultipartReader{
+        src:          body,
+        tmp:          make([]byte, 4096),
+        dashBoundary: []byte("--" + boundary),
+        delim:        []byte("\r\n--" + boundary),
+        limits:       limits.withDefaults(),
+    }
+    // A virtual CRLF lets the first boundary be found like any other
+    // delimiter, with everything before it treated as preamble.
+    mr.buf = append(mr.buf, '\r', '\n')
+    mr.cur = &Part{mr: mr}
+    return mr, nil
+}
+
+// validateBoundary checks the boundary syntax of RFC 2046 section 5.1.1.
+func validateBoundary(b string) error {
+    if len(b) == 0 || len(b) > 70 {
+        return fmt.Errorf("%w: boundary must be 1 to 70 characters", ErrInvalidMultipart)
+    }
+    if b[len(b)-1] == ' ' {
+        return fmt.Errorf("%w: boundary ends with a space", ErrInvalidMultipart)
+    }
+    for i := 0; i < len(b); i++ {
+        c := b[i]
+        if !isUnreserved(c) && strings.IndexByte("'()+_,/:=? ", c) == -1 {
+            return fmt.Errorf("%w: invalid character %q in boundary", ErrInvalidMultipart, c)
+        }
+    }
+    return nil
+}
+
+// fill reads more of the body into buf.
+func (mr *MultipartReader) fill() error {
+    if mr.srcErr != nil {
+        return mr.srcErr
+    }
+    n, err := mr.src.Read(mr.tmp)
+    mr.buf = append(mr.buf, mr.tmp[:n]...)
+    mr.total += n
+    if exceeds(mr.total, mr.limits.MaxMultipartBytes) {
+        mr.srcErr = ErrMultipartTooLarge
+        return mr.srcErr
+    }
+    if err != nil {
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        mr.srcErr = err
+        if n > 0 {
+            return nil
+        }
+        return err
+    }
+    return nil
+}
+
+// NextPart returns the next part, discarding any unread content of the
+// previous one. It returns io.EOF after the final boundary.
+func (mr *MultipartReader) NextPart() (*Part, error) {
+    if mr.err != nil {
+        return nil, mr.err
+    }
+    if mr.done {
+        return nil, io.EOF
+    }
+    p, err := mr.nextPart()
+    if err != nil && err != io.EOF {
+        mr.err = err
+    }
+    return p, err
+}
+
+func (mr *MultipartReader) nextPart() (*Part, error) {
+    // Skip the rest of the current part (or the preamble).
+    if _, err := io.Copy(io.Discard, mr.cur); err != nil {
+        return nil, err
+    }
+    mr.cur = nil
+    // The buffer now starts with the delimiter; look at what follows it.
+    for len(mr.buf) < len(mr.delim)+2 {
+        if err := mr.fill(); err != nil {
+            return nil, err
+        }
+    }
+    rest := mr.buf[len(mr.delim):]
+    if rest[0] == '-' && rest[1] == '-' {
+        // Close delimiter; the epilogue is ignored.
+        mr.done = true
+        mr.buf = nil
+        return nil, io.EOF
+    }
+    // Skip transport padding up to the CRLF ending the boundary line.
+    i := len(mr.delim)
+    for {
+        for i < len(mr.buf) && (mr.buf[i] == ' ' || mr.buf[i] == '\t') {
+            i++
+        }
+        if i+1 < len(mr.buf) {
+            break
+        }
+        if exceeds(i, mr.limits.MaxHeaderBytes) {
+            return nil, fmt.Errorf("%w: boundary line too long", ErrInvalidMultipart)
+        }
+        if err := mr.fill(); err != nil {
+            return nil, err
+        }
+    }
+    if mr.buf[i] != '\r' || mr.buf[i+1] != '\n' {
+        return nil, fmt.Errorf("%w: boundary not followed by CRLF", ErrInvalidMultipart)
+    }
+    mr.buf = mr.buf[i+2:]
+
+    p := &Part{Headers: headers.NewHeaders(), mr: mr}
+    if err := mr.readPartHeaders(p.Headers); err != nil {
+        return nil, err
+    }
+    if cd := p.Headers.Get("Content-Disposition"); cd != "" {
+        disposition, params, err := headers.ParseMediaType(cd)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalidMultipart, err)
+        }
+        if disposition == "form-data" {
+            p.formName = params["name"]
+            p.fileName = params["filename"]
+        }
+    }
+    mr.cur = p
+    return p, nil
+}
+
+// readPartHeaders parses the header section of a part into h.
+func (mr *MultipartReader) readPartHeaders(h *headers.Headers) error {
+    size, count := 0, 0
+    fields := headers.Parser{Mode: mr.HeaderMode}
+    for {
+        n, done, err := fields.Parse(h, mr.buf)
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrInvalidMultipart, err)
+        }
+        if n == 0 {
+            if exceeds(size+len(mr.buf), mr.limits.MaxHeaderBytes) {
+                return ErrHeaderTooLarge
+            }
+            if err := mr.fill(); err != nil {
+                return err
+            }
+            continue
+        }
+        mr.buf = mr.buf[n:]
+        size += n
+        if done {
+            return nil
+        }
+        count++
+        if exceeds(count, mr.limits.MaxHeaderCount) || exceeds(size, mr.limits.MaxHeaderBytes) {
+            return ErrHeaderTooLarge
+        }
+    }
+}
+
+// FormName returns the name parameter of a form-data Content-Disposition.
+func (p *Part) FormName() string { return p.formName }
+
+// FileName returns the base name from the filename parameter of a
+// form-data Content-Disposition, or "" if the part is not a file.
+// Directory components are stripped.
+func (p *Part) FileName() string {
+    if p.fileName == "" {
+        return ""
+    }
+    name := path.Base(strings.ReplaceAll(p.fileName, "\\", "/"))
+    if name == "/" || name == "." || name == ".." {
+        return ""
+    }
+    return name
+}
+
+// Read reads the content of the part. It returns io.EOF at the delimiter
+// that ends the part.
+func (p *Part) Read(b []byte) (int, error) {
+    if p.done {
+        return 0, io.EOF
+    }
+    if len(b) == 0 {
+        return 0, nil
+    }
+    mr := p.mr
+    for {
+        avail, atDelim := mr.scan()
+        if atDelim {
+            p.done = true
+            return 0, io.EOF
+        }
+        if avail > 0 {
+            // The preamble has no headers and is not limited like a part.
+            if p.Headers != nil && mr.limits.MaxPartBytes > 0 {
+                // Hand out no byte beyond the limit.
+                allowed := mr.limits.MaxPartBytes - p.read
+                if allowed <= 0 {
+                    return 0, ErrPartTooLarge
+                }
+                avail = min(avail, allowed)
+            }
+            n := copy(b, mr.buf[:avail])
+            mr.buf = mr.buf[n:]
+            p.read += n
+            return n, nil
+        }
+        if err := mr.fill(); err != nil {
+            return 0, err
+        }
+    }
+}
+
+// scan looks for the delimiter that ends the current part. It returns the
+// number of bytes at the start of buf that are certainly part content, and
+// whether buf starts with the delimiter.
+func (mr *MultipartReader) scan() (int, bool) {
+    from := 0
+    for {
+        i := bytes.Index(mr.buf[from:], mr.delim)
+        if i == -1 {
+            // Keep back anything that could be the start of a delimiter.
+            return max(len(mr.buf)-len(mr.delim)+1, from), false
+        }
+        idx := from + i
+        switch isBoundaryEnd(mr.buf[idx+len(mr.delim):]) {
+        case boundaryYes:
+            return idx, idx == 0
+        case boundaryMaybe:
+            return idx, false
+        }
+        // The boundary is only a prefix of longer content, such as "--XyZnot".
+        from = idx + 1
+    }
+}
+
+type boundaryMatch int
+
+const (
+    boundaryNo boundaryMatch = iota
+    boundaryYes
+    boundaryMaybe
+)
+
+// isBoundaryEnd reports whether rest, the bytes after a delimiter match,
+// complete a boundary line: "--" for the close delimiter, or optional
+// transport padding followed by CRLF. It answers boundaryMaybe when more
+// bytes are needed to tell.
+func isBoundaryEnd(rest []byte) boundaryMatch {
+    if len(rest) < 2 {
+        if len(rest) == 1 && rest[0] != '-' && rest[0] != '\r' && rest[0] != ' ' && rest[0] != '\t' {
+            return boundaryNo
+        }
+        return boundaryMaybe
+    }
+    if rest[0] == '-' && rest[1] == '-' {
+        return boundaryYes
+    }
+    i := 0
+    for i < len(rest) && (rest[i] == ' ' || rest[i] == '\t') {
+        i++
+    }
+    switch {
+    case i == len(rest):
+        return boundaryMaybe
+    case rest[i] != '\r':
+        return boundaryNo
+    case i+1 == len(rest):
+        return boundaryMaybe
+    case rest[i+1] == '\n':
+        return boundaryYes
+    default:
+        return boundaryNo
+    }
+}
+
+// Close discards the rest of the part.
+func (p *Part) Close() error {
+    _, err := io.Copy(io.Discard, p)
+    return err
+}
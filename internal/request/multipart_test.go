@@ -0,0 +1,207 @@
+package request
+
+import (
+    "io"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+const testMultipartBody = "preamble to ignore\r\n" +
+    "--XyZ\r\n" +
+    "Content-Disposition: form-data; name=\"title\"\r\n" +
+    "\r\n" +
+    "My upload\r\n" +
+    "--XyZ  \r\n" +
+    "Content-Disposition: form-data; name=\"file\"; filename=\"../../etc/vim.txt\"\r\n" +
+    "Content-Type: text/plain\r\n" +
+    "\r\n" +
+    "line one\r\n--XyZnot a boundary\r\nline three\r\n" +
+    "--XyZ--\r\n" +
+    "epilogue"
+
+func multipartRequest(t *testing.T, body string, limits Limits, perRead int) *Request {
+    t.Helper()
+    reader := &chunkReader{
+        data: "POST /upload HTTP/1.1\r\n" +
+            "Content-Type: multipart/form-data; boundary=\"XyZ\"\r\n" +
+            "Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+            "\r\n" + body,
+        numBytesPerRead: perRead,
+    }
+    r, err := NewReaderWithLimits(reader, limits).ReadRequest()
+    require.NoError(t, err)
+    return r
+}
+
+func Test_Multipart_Parts(t *testing.T) {
+    r := multipartRequest(t, testMultipartBody, Limits{}, 7)
+    mr, err := r.MultipartReader()
+    require.NoError(t, err)
+
+    p, err := mr.NextPart()
+    require.NoError(t, err)
+    assert.Equal(t, "title", p.FormName())
+    assert.Equal(t, "", p.FileName())
+    data, err := io.ReadAll(p)
+    require.NoError(t, err)
+    assert.Equal(t, "My upload", string(data))
+
+    p, err = mr.NextPart()
+    require.NoError(t, err)
+    assert.Equal(t, "file", p.FormName())
+    assert.Equal(t, "vim.txt", p.FileName())
+    assert.Equal(t, "text/plain", p.Headers.Get("Content-Type"))
+    buf := make([]byte, 3)
+    var got []byte
+    for {
+        n, err := p.Read(buf)
+        got = append(got, buf[:n]...)
+        if err == io.EOF {
+            break
+        }
+        require.NoError(t, err)
+    }
+    assert.Equal(t, "line one\r\n--XyZnot a boundary\r\nline three", string(got))
+
+    _, err = mr.NextPart()
+    assert.Equal(t, io.EOF, err)
+    _, err = mr.NextPart()
+    assert.Equal(t, io.EOF, err)
+}
+
+func Test_Multipart_Skips_Unread_Parts(t *testing.T) {
+    r := multipartRequest(t, testMultipartBody, Limits{}, 64)
+    mr, err := r.MultipartReader()
+    require.NoError(t, err)
+    names := []string{}
+    for {
+        p, err := mr.NextPart()
+        if err == io.EOF {
+            break
+        }
+        require.NoError(t, err)
+        names = append(names, p.FormName())
+    }
+    assert.Equal(t, []string{"title", "file"}, names)
+}
+
+func Test_Multipart_Part_Limit(t *testing.T) {
+    r := multipartRequest(t, testMultipartBody, Limits{MaxPartBytes: 10}, 64)
+    mr, err := r.MultipartReader()
+    require.NoError(t, err)
+    p, err := mr.NextPart()
+    require.NoError(t, err)
+    _, err = io.ReadAll(p)
+    require.NoError(t, err)
+    p, err = mr.NextPart()
+    require.NoError(t, err)
+    _, err = io.ReadAll(p)
+    assert.ErrorIs(t, err, ErrPartTooLarge)
+}
+
+func Test_Multipart_Part_Limit_Boundary(t *testing.T) {
+    const limit = 10
+    for _, size := range []int{limit - 1, limit, limit + 1} {
+        content := strings.Repeat("x", size)
+        body := "--XyZ\r\nContent-Disposition: form-data; name=\"f\"\r\n\r\n" + content + "\r\n--XyZ--\r\n"
+        for _, perRead := range []int{1, 64} {
+            r := multipartRequest(t, body, Limits{MaxPartBytes: limit}, perRead)
+            mr, err := r.MultipartReader()
+            require.NoError(t, err)
+            p, err := mr.NextPart()
+            require.NoError(t, err)
+            data, err := io.ReadAll(p)
+            if size > limit {
+                assert.ErrorIs(t, err, ErrPartTooLarge, "size %d", size)
+                assert.Equal(t, content[:limit], string(data), "size %d", size)
+                continue
+            }
+            require.NoError(t, err, "size %d", size)
+            assert.Equal(t, content, string(data))
+        }
+    }
+}
+
+func Test_Multipart_Total_Limit(t *testing.T) {
+    r := multipartRequest(t, testMultipartBody, Limits{MaxMultipartBytes: 50}, 64)
+    mr, err := NewMultipartReader(r.BodyReader, "XyZ", r.limits)
+    require.NoError(t, err)
+    _, err = mr.NextPart()
+    if err == nil {
+        _, err = mr.NextPart()
+    }
+    assert.ErrorIs(t, err, ErrMultipartTooLarge)
+}
+
+func Test_Multipart_Errors(t *testing.T) {
+    r, err := RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Type: text/plain\r\n\r\n"))
+    require.NoError(t, err)
+    _, err = r.MultipartReader()
+    assert.ErrorIs(t, err, ErrNotMultipart)
+
+    _, err = NewMultipartReader(strings.NewReader(""), "", Limits{})
+    assert.ErrorIs(t, err, ErrInvalidMultipart)
+    _, err = NewMultipartReader(strings.NewReader(""), "bad\"boundary", Limits{})
+    assert.ErrorIs(t, err, ErrInvalidMultipart)
+
+    // Missing close delimiter.
+    mr, err := NewMultipartReader(strings.NewReader("--b\r\n\r\ndata without end"), "b", Limits{})
+    require.NoError(t, err)
+    p, err := mr.NextPart()
+    require.NoError(t, err)
+    _, err = io.ReadAll(p)
+    assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+    // A boundary prefix inside the preamble is not a boundary, so no part is found.
+    mr, err = NewMultipartReader(strings.NewReader("--bxx\r\n\r\ndata"), "b", Limits{})
+    require.NoError(t, err)
+    _, err = mr.NextPart()
+    assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+    // An empty multipart body has only the close delimiter.
+    mr, err = NewMultipartReader(strings.NewReader("--b--\r\n"), "b", Limits{})
+    require.NoError(t, err)
+    _, err = mr.NextPart()
+    assert.Equal(t, io.EOF, err)
+}
+
+func Test_Multipart_Header_Mode(t *testing.T) {
+    body := "--XyZ\r\n" +
+        "Content-Disposition: form-data;\r\n name=\"title\"\r\n" +
+        "\r\n" +
+        "hi\r\n" +
+        "--XyZ--\r\n"
+
+    // Part headers are strict by default: no obs-fold, no control bytes.
+    mr, err := NewMultipartReader(strings.NewReader(body), "XyZ", Limits{})
+    require.NoError(t, err)
+    _, err = mr.NextPart()
+    assert.ErrorIs(t, err, ErrInvalidMultipart)
+    assert.ErrorContains(t, err, headers.ErrObsFold.Error())
+
+    mr, err = NewMultipartReader(strings.NewReader("--XyZ\r\nX-A: a\x00b\r\n\r\nhi\r\n--XyZ--\r\n"), "XyZ", Limits{})
+    require.NoError(t, err)
+    _, err = mr.NextPart()
+    assert.ErrorIs(t, err, ErrInvalidMultipart)
+
+    // A request read in Lenient mode passes its mode on to the parts.
+    raw := "POST /upload HTTP/1.1\r\n" +
+        "Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+        "Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+        "\r\n" + body
+    cr := NewReader(strings.NewReader(raw))
+    cr.HeaderMode = headers.Lenient
+    r, err := cr.ReadRequest()
+    require.NoError(t, err)
+    mr, err = r.MultipartReader()
+    require.NoError(t, err)
+    p, err := mr.NextPart()
+    require.NoError(t, err)
+    assert.Equal(t, "title", p.FormName())
+}
@@ -3,6 +3,7 @@ package request
 import (
     "bytes"
     "errors"
+    "fmt"
     "io"
     "strings"
 
@@ -11,80 +12,180 @@ import (
 
 type Request struct {
     RequestLine RequestLine
-    Headers     headers.Headers
-    Body        []byte
-    state       parserState
+    Headers     *headers.Headers
+    // Body holds the whole message body once ReadBody has been called.
+    // RequestFromReader fills it; RequestHeadFromReader leaves it nil.
+    Body []byte
+    // BodyReader streams the message body from the underlying reader,
+    // decoding Content-Length or chunked framing as it goes.
+    BodyReader io.ReadCloser
+    // Trailers holds the trailer fields sent after the last chunk of a
+    // chunked body. It is nil unless the request used chunked framing.
+    Trailers *headers.Headers
+    state    parserState
+    // bodyLeft is the number of body bytes still expected, either for the
+    // whole Content-Length body or for the current chunk.
+    bodyLeft int
+    // bodyRead is the number of decoded body bytes seen so far.
+    bodyRead int
+    // fieldBytes and fieldCount track the size of the header and trailer
+    // sections against limits.
+    fieldBytes int
+    fieldCount int
+    fields     headers.Parser
+    limits     Limits
+    // offset is the number of bytes of this request consumed so far.
+    offset int
+    // query and form cache the results of Query and Form.
+    query    Values
+    queryErr error
+    form     Values
+    formErr  error
+    formDone bool
+    // hasBody records whether the framing announced a body.
+    hasBody bool
+    // ambiguousFraming is set when both Transfer-Encoding and
+    // Content-Length were sent.
+    ambiguousFraming bool
 }
 
 type RequestLine struct {
     HttpVersion   string
     RequestTarget string
     Method        string
+    // URL is RequestTarget classified and parsed into its parts.
+    URL URL
 }
 
-// RequestFromReader parses an HTTP request from reader incrementally.
-// It reads chunks and feeds them to the Request parser until the
-// request-line has been fully parsed.
+// RequestFromReader parses an HTTP request from reader incrementally,
+// including the whole body, which is stored in Request.Body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-    r := &Request{state: stateInitialized, Headers: headers.NewHeaders()}
+    r, err := RequestHeadFromReader(reader)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := r.ReadBody(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
 
-    // Accumulation buffer for bytes read but not yet parsed/consumed.
-    buf := make([]byte, 0, 32)
-    tmp := make([]byte, 8)
+// RequestHeadFromReader parses the request-line and headers from reader and
+// returns as soon as the header section is complete. The body is not read;
+// it is pulled from reader lazily through Request.BodyReader.
+// Bytes past the end of the request are discarded; use a Reader to parse
+// several requests from one connection.
+func RequestHeadFromReader(reader io.Reader) (*Request, error) {
+    r, err := NewReader(reader).ReadRequest()
+    if err == io.EOF {
+        return nil, &ParseError{Category: CategoryRequestLine, StatusCode: 400, Err: ErrIncompleteRequest}
+    }
+    return r, err
+}
 
-    for {
-        if len(buf) > 0 {
-            consumed, err := r.parse(buf)
-            if err != nil {
-                return nil, err
-            }
-            if consumed > 0 {
-                buf = buf[consumed:]
-            }
-            if r.state == stateDone {
-                return r, nil
-            }
+// Reader reads consecutive requests from a single connection. It owns the
+// read buffer, so bytes received past the end of one request are kept and
+// parsed as the start of the next one.
+type Reader struct {
+    // Limits bounds each request read. It may be changed between calls to
+    // ReadRequest.
+    Limits Limits
+    // HeaderMode selects how header and trailer lines are validated. The
+    // zero value is headers.Strict.
+    HeaderMode headers.Mode
+    src        *source
+    last       *bodyReader
+}
+
+// NewReader returns a Reader that parses requests from conn using DefaultLimits.
+func NewReader(conn io.Reader) *Reader {
+    return &Reader{src: newSource(conn)}
+}
+
+// NewReaderWithLimits returns a Reader that parses requests from conn
+// using the given limits.
+func NewReaderWithLimits(conn io.Reader, limits Limits) *Reader {
+    return &Reader{Limits: limits, src: newSource(conn)}
+}
+
+// ReadRequest parses the head of the next request on the connection. Any
+// unread body of the previous request is discarded first. It returns io.EOF
+// if the connection is closed cleanly before a new request starts.
+func (cr *Reader) ReadRequest() (*Request, error) {
+    if cr.last != nil {
+        if err := cr.last.drain(); err != nil {
+            return nil, fmt.Errorf("%w: %w", ErrUnreadBody, err)
         }
+        cr.last = nil
+    }
+    r, err := readHead(cr.src, cr.Limits, cr.HeaderMode)
+    if err != nil {
+        return nil, err
+    }
+    cr.last = r.BodyReader.(*bodyReader)
+    return r, nil
+}
+
+// Buffered returns the number of bytes read from the connection but not
+// yet consumed by a request.
+func (cr *Reader) Buffered() int { return len(cr.src.buf) }
 
-        // Allow state transitions that don't require additional bytes (e.g., no body)
-        if len(buf) == 0 && r.state != stateDone {
-            if _, err := r.parse(nil); err != nil {
+// readHead feeds bytes from src to a new Request until its header section
+// has been parsed, then prepares the body reader.
+func readHead(src *source, limits Limits, mode headers.Mode) (*Request, error) {
+    r := &Request{
+        state:   stateInitialized,
+        Headers: headers.NewHeaders(),
+        fields:  headers.Parser{Mode: mode},
+        limits:  limits.withDefaults(),
+    }
+    started := false
+    for {
+        if len(src.buf) > 0 {
+            started = true
+            consumed, err := r.parse(src.buf)
+            if err != nil {
                 return nil, err
             }
-            if r.state == stateDone {
-                return r, nil
+            src.buf = src.buf[consumed:]
+            if r.state == stateParsingBody {
+                break
             }
         }
-
         // Need more data
-        n, err := reader.Read(tmp)
-        if n > 0 {
-            buf = append(buf, tmp[:n]...)
-        }
-        if err == io.EOF {
-            // Try one last parse attempt on whatever remains.
-            if len(buf) > 0 && r.state != stateDone {
-                if consumed, perr := r.parse(buf); perr != nil {
-                    return nil, perr
-                } else if consumed > 0 {
-                    buf = buf[consumed:]
-                }
-            }
-            // Allow state transitions that don't require additional data (e.g., no body)
-            if r.state != stateDone {
-                if _, perr := r.parse(nil); perr != nil {
-                    return nil, perr
+        if err := src.fill(); err != nil {
+            if err == io.EOF {
+                // A connection closed after nothing but empty lines ends
+                // cleanly too.
+                if !started || r.state == stateInitialized && len(src.buf) == 0 {
+                    return nil, io.EOF
                 }
+                return nil, r.wrapError(ErrIncompleteRequest)
             }
-            if r.state == stateDone {
-                return r, nil
-            }
-            return nil, errors.New("incomplete request")
-        }
-        if err != nil {
             return nil, err
         }
     }
+    if err := r.startBody(); err != nil {
+        return nil, r.wrapError(err)
+    }
+    r.BodyReader = &bodyReader{req: r, src: src}
+    return r, nil
+}
+
+// ReadBody reads the rest of the body from BodyReader into Body and
+// returns it. Calling it again returns the already read Body.
+func (r *Request) ReadBody() ([]byte, error) {
+    if r.BodyReader == nil || r.state == stateDone {
+        return r.Body, nil
+    }
+    body, err := io.ReadAll(r.BodyReader)
+    if err != nil {
+        return nil, err
+    }
+    if len(body) > 0 {
+        r.Body = body
+    }
+    return r.Body, nil
 }
 
 type parserState int
@@ -93,48 +194,71 @@ const (
     stateInitialized parserState = iota
     stateParsingHeaders
     stateParsingBody
+    stateParsingFixedBody
+    stateParsingChunkSize
+    stateParsingChunkData
+    stateParsingChunkDataEnd
+    stateParsingTrailers
     stateDone
 )
 
-// parse consumes bytes from data and updates the Request.
+// parse consumes bytes from data and updates the Request until the
+// header section is complete.
 // It returns the number of bytes consumed from data and an error if parsing fails.
 func (r *Request) parse(data []byte) (int, error) {
-    if r.state == stateDone {
+    if r.state >= stateParsingBody {
         return 0, nil
     }
     total := 0
     for {
         n, err := r.parseSingle(data[total:])
         if err != nil {
-            return total, err
+            return total, r.wrapError(err)
         }
         if n == 0 {
             break
         }
         total += n
-        if r.state == stateDone || total == len(data) {
+        r.offset += n
+        if r.state >= stateParsingBody || total == len(data) {
             break
         }
     }
     return total, nil
 }
 
-// parseSingle processes a single step depending on the current parser state.
+// parseSingle processes a single step of the request-line and header parsing.
 func (r *Request) parseSingle(data []byte) (int, error) {
     switch r.state {
     case stateInitialized:
+        // Empty lines before the request-line, such as a CRLF a client
+        // sent after the previous body, are ignored (RFC 9112, 2.2). They
+        // count against the request-line limit; offset holds them so far.
+        if len(data) >= 2 && data[0] == '\r' && data[1] == '\n' {
+            if exceeds(r.offset+2, r.limits.MaxRequestLineBytes) {
+                return 0, ErrRequestLineTooLong
+            }
+            return 2, nil
+        }
         consumed, rl, err := parseRequestLine(data)
         if err != nil {
             return 0, err
         }
         if consumed == 0 {
+            // Allow for the CR of a CRLF that is not complete yet.
+            if exceeds(len(data)-1, r.limits.MaxRequestLineBytes) {
+                return 0, ErrRequestLineTooLong
+            }
             return 0, nil
         }
+        if exceeds(consumed-2, r.limits.MaxRequestLineBytes) {
+            return 0, ErrRequestLineTooLong
+        }
         r.RequestLine = rl
         r.state = stateParsingHeaders
         return consumed, nil
     case stateParsingHeaders:
-        n, done, err := r.Headers.Parse(data)
+        n, done, err := r.parseField(r.Headers, data)
         if err != nil {
             return 0, err
         }
@@ -145,47 +269,42 @@ func (r *Request) parseSingle(data []byte) (int, error) {
             r.state = stateParsingBody
         }
         return n, nil
-    case stateParsingBody:
-        // Determine desired content length from headers; if missing, we're done.
-        clStr := r.Headers.Get("Content-Length")
-        if clStr == "" {
-            r.state = stateDone
-            // Nothing to parse; report consuming all provided data to advance buffer.
-            return len(data), nil
-        }
-        // Parse content length
-        var want int
-        for i := 0; i < len(clStr); i++ {
-            c := clStr[i]
-            if c < '0' || c > '9' {
-                return 0, errors.New("invalid Content-Length")
-            }
-            want = want*10 + int(c-'0')
-        }
-        // Append all data given
-        if len(data) > 0 {
-            r.Body = append(r.Body, data...)
-        }
-        // If we've reached the desired length, we're done
-        if len(r.Body) == want {
-            r.state = stateDone
-        }
-        // If we've exceeded, error
-        if len(r.Body) > want {
-            return len(data), errors.New("body exceeds Content-Length")
-        }
-        // Report consumed bytes (entire slice provided)
-        return len(data), nil
-    case stateDone:
-        return 0, nil
     default:
         return 0, errors.New("invalid parser state")
     }
 }
 
+// parseField parses one header or trailer line into h while enforcing the
+// header size and count limits.
+func (r *Request) parseField(h *headers.Headers, data []byte) (int, bool, error) {
+    n, done, err := r.fields.Parse(h, data)
+    if err != nil {
+        return 0, false, err
+    }
+    if n == 0 {
+        // Incomplete line; make sure it cannot grow without bound.
+        if exceeds(r.fieldBytes+len(data), r.limits.MaxHeaderBytes) {
+            return 0, false, ErrHeaderTooLarge
+        }
+        return 0, false, nil
+    }
+    r.fieldBytes += n
+    if exceeds(r.fieldBytes, r.limits.MaxHeaderBytes) {
+        return 0, false, ErrHeaderTooLarge
+    }
+    if !done {
+        r.fieldCount++
+        if exceeds(r.fieldCount, r.limits.MaxHeaderCount) {
+            return 0, false, ErrHeaderTooLarge
+        }
+    }
+    return n, done, nil
+}
+
 // parseRequestLine attempts to parse a request-line from the beginning of data.
 // It returns the number of bytes consumed (including the trailing CRLF),
 // the parsed RequestLine, and an error. If no CRLF is found, it returns (0, _, nil).
+// The line is scanned in place; only the request-target is copied.
 func parseRequestLine(data []byte) (int, RequestLine, error) {
     // Find LF; require preceding CR for CRLF
     lf := bytes.IndexByte(data, '\n')
@@ -193,40 +312,171 @@ func parseRequestLine(data []byte) (int, RequestLine, error) {
         return 0, RequestLine{}, nil
     }
     if lf == 0 || data[lf-1] != '\r' {
-        return 0, RequestLine{}, errors.New("invalid request line ending: expected CRLF")
+        return 0, RequestLine{}, fmt.Errorf("%w: expected CRLF", ErrInvalidRequestLine)
     }
-    line := string(data[:lf-1]) // exclude CR
+    line := data[:lf-1] // exclude CR
 
-    parts := strings.Fields(line)
-    if len(parts) != 3 {
-        return 0, RequestLine{}, errors.New("invalid request line: want 3 parts")
+    var parts [3][]byte
+    n := 0
+    for i := 0; i < len(line); {
+        if isLineSpace(line[i]) {
+            i++
+            continue
+        }
+        j := i
+        for j < len(line) && !isLineSpace(line[j]) {
+            j++
+        }
+        if n == len(parts) {
+            return 0, RequestLine{}, fmt.Errorf("%w: want 3 parts", ErrInvalidRequestLine)
+        }
+        parts[n] = line[i:j]
+        n++
+        i = j
+    }
+    if n != len(parts) {
+        return 0, RequestLine{}, fmt.Errorf("%w: want 3 parts", ErrInvalidRequestLine)
     }
 
-    method := parts[0]
-    for i := 0; i < len(method); i++ {
-        c := method[i]
+    for _, c := range parts[0] {
         if c < 'A' || c > 'Z' {
-            return 0, RequestLine{}, errors.New("invalid method")
+            return 0, RequestLine{}, ErrInvalidMethod
         }
     }
+    method := internMethod(parts[0])
 
-    target := parts[1]
-
-    versionPart := parts[2]
-    const prefix = "HTTP/"
-    if !strings.HasPrefix(versionPart, prefix) {
-        return 0, RequestLine{}, errors.New("invalid http version format")
+    target := string(parts[1])
+    u, err := parseTarget(method, target)
+    if err != nil {
+        return 0, RequestLine{}, err
     }
-    ver := strings.TrimPrefix(versionPart, prefix)
-    if ver != "1.1" {
-        return 0, RequestLine{}, errors.New("unsupported http version")
+
+    ver, err := parseVersion(parts[2])
+    if err != nil {
+        return 0, RequestLine{}, err
     }
 
     rl := RequestLine{
         Method:        method,
         RequestTarget: target,
         HttpVersion:   ver,
+        URL:           u,
     }
     // consumed bytes include CRLF; lf is index of LF; consumed = lf+1
     return lf + 1, rl, nil
 }
+
+// isLineSpace reports whether c separates the parts of a request-line.
+func isLineSpace(c byte) bool {
+    return c == ' ' || c == '\t' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// internMethod returns the method as a string, without allocating for the
+// standard methods.
+func internMethod(b []byte) string {
+    switch string(b) {
+    case "GET":
+        return "GET"
+    case "HEAD":
+        return "HEAD"
+    case "POST":
+        return "POST"
+    case "PUT":
+        return "PUT"
+    case "DELETE":
+        return "DELETE"
+    case "CONNECT":
+        return "CONNECT"
+    case "OPTIONS":
+        return "OPTIONS"
+    case "TRACE":
+        return "TRACE"
+    case "PATCH":
+        return "PATCH"
+    }
+    return string(b)
+}
+
+// parseVersion parses HTTP-version = HTTP-name "/" DIGIT "." DIGIT and
+// returns the "major.minor" part. Only 1.0 and 1.1 are supported.
+func parseVersion(b []byte) (string, error) {
+    switch string(b) {
+    case "HTTP/1.1":
+        return "1.1", nil
+    case "HTTP/1.0":
+        return "1.0", nil
+    }
+    const prefix = "HTTP/"
+    if !bytes.HasPrefix(b, []byte(prefix)) {
+        return "", ErrInvalidVersion
+    }
+    ver := b[len(prefix):]
+    if len(ver) != 3 || ver[1] != '.' || !isDigit(ver[0]) || !isDigit(ver[2]) {
+        return "", ErrInvalidVersion
+    }
+    return "", ErrUnsupportedVersion
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// ProtoAtLeast reports whether the request's HTTP version is at least major.minor.
+func (r *Request) ProtoAtLeast(major, minor int) bool {
+    v := r.RequestLine.HttpVersion
+    if len(v) != 3 {
+        return false
+    }
+    maj, min := int(v[0]-'0'), int(v[2]-'0')
+    return maj > major || maj == major && min >= minor
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue"
+// and waits for an interim 100 response before sending the body.
+// HTTP/1.0 clients cannot receive interim responses, so it is always false
+// for them.
+func (r *Request) ExpectsContinue() bool {
+    return r.ProtoAtLeast(1, 1) && strings.EqualFold(strings.TrimSpace(r.Headers.Get("Expect")), "100-continue")
+}
+
+// OnBodyRead registers fn to be called once, just before the body is first
+// read from the connection. The server uses it to answer
+// "Expect: 100-continue" only when the handler actually wants the body.
+// If fn returns an error, the read fails with it.
+func (r *Request) OnBodyRead(fn func() error) {
+    if b, ok := r.BodyReader.(*bodyReader); ok {
+        b.onRead = fn
+    }
+}
+
+// HasBody reports whether the request framing announces a body, that is
+// a non-zero Content-Length or chunked transfer coding.
+func (r *Request) HasBody() bool { return r.hasBody }
+
+// BodyError returns the error that stopped BodyReader, or nil if the body
+// has not failed. A *ParseError carries the status code to answer with,
+// such as 413 when the body exceeds Limits.MaxBodyBytes.
+func (r *Request) BodyError() error {
+    if b, ok := r.BodyReader.(*bodyReader); ok {
+        return b.err
+    }
+    return nil
+}
+
+// KeepAlive reports whether the client wants the connection kept open after
+// this request. HTTP/1.1 connections are persistent unless the client sends
+// "Connection: close"; HTTP/1.0 connections close unless the client asks for
+// "Connection: keep-alive". It is always false after a request whose
+// framing was ambiguous, such as one with both Transfer-Encoding and
+// Content-Length.
+func (r *Request) KeepAlive() bool {
+    if r.ambiguousFraming {
+        return false
+    }
+    conn := r.Headers.Get("Connection")
+    if headers.ContainsToken(conn, "close") {
+        return false
+    }
+    if r.ProtoAtLeast(1, 1) {
+        return true
+    }
+    return headers.ContainsToken(conn, "keep-alive")
+}
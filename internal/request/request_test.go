@@ -2,11 +2,14 @@ package request
 
 import (
 	"io"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/xaitan80/httpfromtcp/internal/headers"
 )
 
 // chunkReader simulates a reader that returns a fixed number of bytes per Read call.
@@ -106,9 +109,9 @@ func Test_Standard_Headers(t *testing.T) {
     r, err := RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "localhost:42069", r.Headers["host"])
-    assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-    assert.Equal(t, "*/*", r.Headers["accept"])
+    assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+    assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+    assert.Equal(t, "*/*", r.Headers.Get("accept"))
 }
 
 // Empty Headers
@@ -133,7 +136,7 @@ func Test_Malformed_Header(t *testing.T) {
     require.Error(t, err)
 }
 
-// Duplicate Headers should append values
+// Duplicate Headers should keep each value
 func Test_Duplicate_Headers(t *testing.T) {
     reader := &chunkReader{
         data:            "GET / HTTP/1.1\r\nCookie: a=1\r\nCookie: b=2\r\n\r\n",
@@ -142,10 +145,11 @@ func Test_Duplicate_Headers(t *testing.T) {
     r, err := RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "a=1,b=2", r.Headers["cookie"])
+    assert.Equal(t, []string{"a=1", "b=2"}, r.Headers.Values("cookie"))
+    assert.Equal(t, "a=1, b=2", r.Headers.Get("cookie"))
 }
 
-// Case Insensitive Headers keys map to lowercase
+// Case Insensitive Headers keys map to canonical form
 func Test_Case_Insensitive_Headers(t *testing.T) {
     reader := &chunkReader{
         data:            "GET / HTTP/1.1\r\nhOsT: localhost\r\nUSER-AGENT: test\r\n\r\n",
@@ -154,8 +158,8 @@ func Test_Case_Insensitive_Headers(t *testing.T) {
     r, err := RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "localhost", r.Headers["host"])
-    assert.Equal(t, "test", r.Headers["user-agent"])
+    assert.Equal(t, "localhost", r.Headers.Get("host"))
+    assert.Equal(t, "test", r.Headers.Get("user-agent"))
 }
 
 // Missing End of Headers should error (EOF before CRLF CRLF)
@@ -182,7 +186,7 @@ func Test_Invalid_Method_Request_Line(t *testing.T) {
 func Test_Invalid_Version_Request_Line(t *testing.T) {
     _, err := RequestFromReader(strings.NewReader("GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n"))
     require.Error(t, err)
-    _, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nHost: localhost:42069\r\n\r\n"))
+    _, err = RequestFromReader(strings.NewReader("GET / HTTP/1.x\r\nHost: localhost:42069\r\n\r\n"))
     require.Error(t, err)
     _, err = RequestFromReader(strings.NewReader("GET / HTTX/1.1\r\nHost: localhost:42069\r\n\r\n"))
     require.Error(t, err)
@@ -259,3 +263,586 @@ func Test_No_Content_Length_But_Body_Exists(t *testing.T) {
     // Body remains empty since we don't read without Content-Length
     assert.Equal(t, 0, len(r.Body))
 }
+
+// Chunked body parsing tests
+func Test_Chunked_Body(t *testing.T) {
+    reader := &chunkReader{
+        data: "POST /upload HTTP/1.1\r\n" +
+            "Host: localhost:42069\r\n" +
+            "Transfer-Encoding: chunked\r\n" +
+            "\r\n" +
+            "5\r\nhello\r\n" +
+            "7;name=value;flag\r\n world!\r\n" +
+            "0\r\n" +
+            "\r\n",
+        numBytesPerRead: 3,
+    }
+    r, err := RequestFromReader(reader)
+    require.NoError(t, err)
+    require.NotNil(t, r)
+    assert.Equal(t, "hello world!", string(r.Body))
+    assert.Empty(t, r.Trailers)
+}
+
+func Test_Chunked_Body_With_Trailers(t *testing.T) {
+    reader := &chunkReader{
+        data: "POST /upload HTTP/1.1\r\n" +
+            "Host: localhost:42069\r\n" +
+            "Transfer-Encoding: chunked\r\n" +
+            "Trailer: X-Checksum\r\n" +
+            "\r\n" +
+            "A\r\n0123456789\r\n" +
+            "0;last=\"yes\"\r\n" +
+            "X-Checksum: abc123\r\n" +
+            "\r\n",
+        numBytesPerRead: 5,
+    }
+    r, err := RequestFromReader(reader)
+    require.NoError(t, err)
+    require.NotNil(t, r)
+    assert.Equal(t, "0123456789", string(r.Body))
+    assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+    assert.Empty(t, r.Headers.Get("X-Checksum"))
+}
+
+func Test_Chunked_Body_Invalid_Size(t *testing.T) {
+    _, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+        "Transfer-Encoding: chunked\r\n" +
+        "\r\n" +
+        "zz\r\nhello\r\n0\r\n\r\n"))
+    require.Error(t, err)
+}
+
+func Test_Chunked_Body_Missing_Chunk_CRLF(t *testing.T) {
+    _, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+        "Transfer-Encoding: chunked\r\n" +
+        "\r\n" +
+        "3\r\nhelloXX0\r\n\r\n"))
+    require.Error(t, err)
+}
+
+func Test_Chunked_Body_Missing_Last_Chunk(t *testing.T) {
+    _, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+        "Transfer-Encoding: chunked\r\n" +
+        "\r\n" +
+        "5\r\nhello\r\n"))
+    require.Error(t, err)
+}
+
+// Streaming body tests
+func Test_Head_Returns_Before_Body(t *testing.T) {
+    // Only the header section is available; the body never arrives.
+    reader := &chunkReader{
+        data: "POST /submit HTTP/1.1\r\n" +
+            "Host: localhost:42069\r\n" +
+            "Content-Length: 13\r\n" +
+            "\r\n",
+        numBytesPerRead: 3,
+    }
+    r, err := RequestHeadFromReader(reader)
+    require.NoError(t, err)
+    require.NotNil(t, r)
+    assert.Nil(t, r.Body)
+    require.NotNil(t, r.BodyReader)
+    _, err = io.ReadAll(r.BodyReader)
+    assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func Test_Streaming_Content_Length_Body(t *testing.T) {
+    reader := &chunkReader{
+        data: "POST /submit HTTP/1.1\r\n" +
+            "Content-Length: 13\r\n" +
+            "\r\n" +
+            "hello world!\n",
+        numBytesPerRead: 4,
+    }
+    r, err := RequestHeadFromReader(reader)
+    require.NoError(t, err)
+    buf := make([]byte, 5)
+    n, err := r.BodyReader.Read(buf)
+    require.NoError(t, err)
+    assert.LessOrEqual(t, n, 5)
+    rest, err := io.ReadAll(r.BodyReader)
+    require.NoError(t, err)
+    assert.Equal(t, "hello world!\n", string(buf[:n])+string(rest))
+    require.NoError(t, r.BodyReader.Close())
+    _, err = r.BodyReader.Read(buf)
+    assert.Error(t, err)
+}
+
+func Test_Streaming_Chunked_Body(t *testing.T) {
+    reader := &chunkReader{
+        data: "POST /upload HTTP/1.1\r\n" +
+            "Transfer-Encoding: chunked\r\n" +
+            "\r\n" +
+            "6\r\nstream\r\n" +
+            "5\r\ning!!\r\n" +
+            "0\r\nX-Done: yes\r\n\r\n",
+        numBytesPerRead: 7,
+    }
+    r, err := RequestHeadFromReader(reader)
+    require.NoError(t, err)
+    assert.Nil(t, r.Trailers)
+    body, err := r.ReadBody()
+    require.NoError(t, err)
+    assert.Equal(t, "streaming!!", string(body))
+    assert.Equal(t, "streaming!!", string(r.Body))
+    assert.Equal(t, "yes", r.Trailers.Get("X-Done"))
+}
+
+// Connection reader tests
+func Test_Reader_Pipelined_Requests(t *testing.T) {
+    reader := &chunkReader{
+        data: "POST /one HTTP/1.1\r\n" +
+            "Content-Length: 5\r\n" +
+            "\r\n" +
+            "first" +
+            "POST /two HTTP/1.1\r\n" +
+            "Transfer-Encoding: chunked\r\n" +
+            "\r\n" +
+            "6\r\nsecond\r\n0\r\n\r\n" +
+            "GET /three HTTP/1.1\r\n" +
+            "Host: localhost\r\n" +
+            "\r\n",
+        numBytesPerRead: 11,
+    }
+    cr := NewReader(reader)
+
+    r1, err := cr.ReadRequest()
+    require.NoError(t, err)
+    assert.Equal(t, "/one", r1.RequestLine.RequestTarget)
+    body, err := r1.ReadBody()
+    require.NoError(t, err)
+    assert.Equal(t, "first", string(body))
+
+    r2, err := cr.ReadRequest()
+    require.NoError(t, err)
+    assert.Equal(t, "/two", r2.RequestLine.RequestTarget)
+    body, err = r2.ReadBody()
+    require.NoError(t, err)
+    assert.Equal(t, "second", string(body))
+
+    r3, err := cr.ReadRequest()
+    require.NoError(t, err)
+    assert.Equal(t, "/three", r3.RequestLine.RequestTarget)
+    assert.Equal(t, "localhost", r3.Headers.Get("Host"))
+
+    _, err = cr.ReadRequest()
+    assert.Equal(t, io.EOF, err)
+}
+
+func Test_Reader_Skips_Unread_Body(t *testing.T) {
+    cr := NewReader(strings.NewReader("POST /one HTTP/1.1\r\n" +
+        "Content-Length: 11\r\n" +
+        "\r\n" +
+        "not read at" +
+        "GET /two HTTP/1.1\r\n" +
+        "\r\n"))
+
+    r1, err := cr.ReadRequest()
+    require.NoError(t, err)
+    require.NoError(t, r1.BodyReader.Close())
+
+    r2, err := cr.ReadRequest()
+    require.NoError(t, err)
+    assert.Equal(t, "/two", r2.RequestLine.RequestTarget)
+    assert.Equal(t, 0, cr.Buffered())
+
+    // The first body is exhausted and cannot read into the second request.
+    n, err := r1.BodyReader.Read(make([]byte, 4))
+    assert.Equal(t, 0, n)
+    assert.Error(t, err)
+}
+
+func Test_Reader_Skips_Empty_Lines_Before_Request(t *testing.T) {
+    // Some clients send an extra CRLF after a body.
+    reader := &chunkReader{
+        data: "\r\nGET /one HTTP/1.1\r\n\r\n" +
+            "POST /two HTTP/1.1\r\n" +
+            "Content-Length: 5\r\n" +
+            "\r\n" +
+            "hello\r\n" +
+            "\r\n\r\nGET /three HTTP/1.1\r\n\r\n" +
+            "\r\n",
+        numBytesPerRead: 3,
+    }
+    cr := NewReader(reader)
+    for _, target := range []string{"/one", "/two", "/three"} {
+        r, err := cr.ReadRequest()
+        require.NoError(t, err)
+        assert.Equal(t, target, r.RequestLine.RequestTarget)
+        _, err = r.ReadBody()
+        require.NoError(t, err)
+    }
+    // Trailing empty lines are not a truncated request.
+    _, err := cr.ReadRequest()
+    assert.Equal(t, io.EOF, err)
+
+    // They are bounded by the request-line limit.
+    limits := Limits{MaxRequestLineBytes: 20}
+    _, err = NewReaderWithLimits(strings.NewReader(strings.Repeat("\r\n", 11)+"GET / HTTP/1.1\r\n\r\n"), limits).ReadRequest()
+    assert.ErrorIs(t, err, ErrRequestLineTooLong)
+}
+
+func Test_Reader_Truncated_Second_Request(t *testing.T) {
+    cr := NewReader(strings.NewReader("GET /one HTTP/1.1\r\n\r\nGET /two HT"))
+    _, err := cr.ReadRequest()
+    require.NoError(t, err)
+    _, err = cr.ReadRequest()
+    require.Error(t, err)
+    assert.NotEqual(t, io.EOF, err)
+}
+
+// Limit tests
+func Test_Limit_Request_Line_Too_Long(t *testing.T) {
+    limits := Limits{MaxRequestLineBytes: 20}
+    _, err := NewReaderWithLimits(strings.NewReader("GET /"+strings.Repeat("a", 100)+" HTTP/1.1\r\n\r\n"), limits).ReadRequest()
+    assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+    // An endless request-line without CRLF is rejected once it crosses the limit.
+    reader := &chunkReader{data: "GET /" + strings.Repeat("a", 1000), numBytesPerRead: 8}
+    _, err = NewReaderWithLimits(reader, limits).ReadRequest()
+    assert.ErrorIs(t, err, ErrRequestLineTooLong)
+    assert.Less(t, reader.pos, 100)
+
+    // Exactly at the limit is fine.
+    _, err = NewReaderWithLimits(strings.NewReader("GET /abcdef HTTP/1.1\r\n\r\n"), limits).ReadRequest()
+    require.NoError(t, err)
+}
+
+func Test_Limit_Header_Bytes(t *testing.T) {
+    limits := Limits{MaxHeaderBytes: 64}
+    reader := &chunkReader{
+        data:            "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("b", 1000) + "\r\n\r\n",
+        numBytesPerRead: 8,
+    }
+    _, err := NewReaderWithLimits(reader, limits).ReadRequest()
+    assert.ErrorIs(t, err, ErrHeaderTooLarge)
+    assert.Less(t, reader.pos, 200)
+}
+
+func Test_Limit_Header_Count(t *testing.T) {
+    limits := Limits{MaxHeaderCount: 2}
+    _, err := NewReaderWithLimits(strings.NewReader("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\n\r\n"), limits).ReadRequest()
+    require.NoError(t, err)
+    _, err = NewReaderWithLimits(strings.NewReader("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n"), limits).ReadRequest()
+    assert.ErrorIs(t, err, ErrHeaderTooLarge)
+}
+
+func Test_Limit_Body_Content_Length(t *testing.T) {
+    limits := Limits{MaxBodyBytes: 10}
+    _, err := NewReaderWithLimits(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world"), limits).ReadRequest()
+    assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func Test_Limit_Body_Chunked(t *testing.T) {
+    limits := Limits{MaxBodyBytes: 10}
+    r, err := NewReaderWithLimits(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"+
+        "6\r\nhello \r\n6\r\nworld!\r\n0\r\n\r\n"), limits).ReadRequest()
+    require.NoError(t, err)
+    _, err = r.ReadBody()
+    assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func Test_Limit_Negative_Disables(t *testing.T) {
+    limits := Limits{MaxHeaderCount: -1}
+    data := "GET / HTTP/1.1\r\n" + strings.Repeat("X-A: 1\r\n", 500) + "\r\n"
+    _, err := NewReaderWithLimits(strings.NewReader(data), limits).ReadRequest()
+    require.NoError(t, err)
+    _, err = NewReader(strings.NewReader(data)).ReadRequest()
+    assert.ErrorIs(t, err, ErrHeaderTooLarge)
+}
+
+// Parse error tests
+func Test_Parse_Error_Details(t *testing.T) {
+    _, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: a\r\nBad Header\r\n\r\n"))
+    var pe *ParseError
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, CategoryHeaders, pe.Category)
+    assert.Equal(t, 25, pe.Offset)
+    assert.Equal(t, 400, pe.StatusCode)
+    assert.ErrorIs(t, err, headers.ErrMissingColon)
+
+    _, err = RequestFromReader(strings.NewReader("get / HTTP/1.1\r\n\r\n"))
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, CategoryRequestLine, pe.Category)
+    assert.Equal(t, 0, pe.Offset)
+    assert.ErrorIs(t, err, ErrInvalidMethod)
+
+    _, err = RequestFromReader(strings.NewReader("GET / HTTP/2.0\r\n\r\n"))
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, 505, pe.StatusCode)
+    assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+    _, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: x\r\n\r\n"))
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, CategoryBody, pe.Category)
+    assert.ErrorIs(t, err, ErrInvalidContentLength)
+
+    _, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\nq\r\n"))
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, CategoryBody, pe.Category)
+    assert.Equal(t, 55, pe.Offset)
+    assert.ErrorIs(t, err, ErrInvalidChunk)
+
+    _, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: a\r\n"))
+    require.ErrorAs(t, err, &pe)
+    assert.ErrorIs(t, err, ErrIncompleteRequest)
+
+    _, err = NewReaderWithLimits(strings.NewReader("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\n\r\n"), Limits{MaxHeaderCount: 1}).ReadRequest()
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, 431, pe.StatusCode)
+    assert.ErrorIs(t, err, ErrHeaderTooLarge)
+}
+
+// HTTP/1.0 tests
+func Test_HTTP10_Request_Line(t *testing.T) {
+    r, err := RequestFromReader(strings.NewReader("GET /health HTTP/1.0\r\n\r\n"))
+    require.NoError(t, err)
+    assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+    assert.True(t, r.ProtoAtLeast(1, 0))
+    assert.False(t, r.ProtoAtLeast(1, 1))
+    assert.False(t, r.KeepAlive())
+}
+
+func Test_Keep_Alive_Negotiation(t *testing.T) {
+    cases := []struct {
+        req  string
+        want bool
+    }{
+        {"GET / HTTP/1.1\r\n\r\n", true},
+        {"GET / HTTP/1.1\r\nConnection: close\r\n\r\n", false},
+        {"GET / HTTP/1.1\r\nConnection: Upgrade, Close\r\n\r\n", false},
+        {"GET / HTTP/1.0\r\n\r\n", false},
+        {"GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n", true},
+    }
+    for _, tc := range cases {
+        r, err := RequestFromReader(strings.NewReader(tc.req))
+        require.NoError(t, err)
+        assert.Equal(t, tc.want, r.KeepAlive(), tc.req)
+    }
+}
+
+// Request-target tests
+func Test_Target_Origin_Form(t *testing.T) {
+    r, err := RequestFromReader(strings.NewReader("GET /video%20clips/a%2Fb?x=1&y=%41 HTTP/1.1\r\n\r\n"))
+    require.NoError(t, err)
+    u := r.RequestLine.URL
+    assert.Equal(t, OriginForm, u.Form)
+    assert.Equal(t, "/video clips/a/b", u.Path)
+    assert.Equal(t, "/video%20clips/a%2Fb", u.RawPath)
+    assert.Equal(t, "x=1&y=%41", u.RawQuery)
+    assert.Equal(t, "/video%20clips/a%2Fb?x=1&y=%41", r.RequestLine.RequestTarget)
+}
+
+func Test_Target_Absolute_Form(t *testing.T) {
+    r, err := RequestFromReader(strings.NewReader("GET HTTP://example.com:8080/a?b HTTP/1.1\r\n\r\n"))
+    require.NoError(t, err)
+    u := r.RequestLine.URL
+    assert.Equal(t, AbsoluteForm, u.Form)
+    assert.Equal(t, "http", u.Scheme)
+    assert.Equal(t, "example.com:8080", u.Host)
+    assert.Equal(t, "/a", u.Path)
+    assert.Equal(t, "b", u.RawQuery)
+
+    r, err = RequestFromReader(strings.NewReader("GET https://[::1]?q HTTP/1.1\r\n\r\n"))
+    require.NoError(t, err)
+    assert.Equal(t, "[::1]", r.RequestLine.URL.Host)
+    assert.Equal(t, "/", r.RequestLine.URL.Path)
+    assert.Equal(t, "q", r.RequestLine.URL.RawQuery)
+}
+
+func Test_Target_Authority_And_Asterisk_Form(t *testing.T) {
+    r, err := RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\n\r\n"))
+    require.NoError(t, err)
+    assert.Equal(t, AuthorityForm, r.RequestLine.URL.Form)
+    assert.Equal(t, "example.com:443", r.RequestLine.URL.Host)
+
+    r, err = RequestFromReader(strings.NewReader("OPTIONS * HTTP/1.1\r\n\r\n"))
+    require.NoError(t, err)
+    assert.Equal(t, AsteriskForm, r.RequestLine.URL.Form)
+}
+
+func Test_Target_Invalid(t *testing.T) {
+    bad := []string{
+        "GET /page#frag HTTP/1.1\r\n\r\n",
+        "GET /bad%zz HTTP/1.1\r\n\r\n",
+        "GET /trunc% HTTP/1.1\r\n\r\n",
+        "GET /q?x=%4 HTTP/1.1\r\n\r\n",
+        "GET /a\"b HTTP/1.1\r\n\r\n",
+        "GET * HTTP/1.1\r\n\r\n",
+        "GET example.com:443 HTTP/1.1\r\n\r\n",
+        "CONNECT example.com HTTP/1.1\r\n\r\n",
+        "GET ftp://example.com/ HTTP/1.1\r\n\r\n",
+        "GET http://user@example.com/ HTTP/1.1\r\n\r\n",
+        "GET http:///path HTTP/1.1\r\n\r\n",
+    }
+    for _, req := range bad {
+        _, err := RequestFromReader(strings.NewReader(req))
+        var pe *ParseError
+        require.ErrorAs(t, err, &pe, req)
+        assert.ErrorIs(t, err, ErrInvalidTarget, req)
+        assert.Equal(t, 400, pe.StatusCode, req)
+        assert.Equal(t, CategoryRequestLine, pe.Category, req)
+    }
+}
+
+// Query and form tests
+func Test_Query(t *testing.T) {
+    r, err := RequestFromReader(strings.NewReader("GET /search?q=go+http&tag=a&tag=b%26c&empty=&flag HTTP/1.1\r\n\r\n"))
+    require.NoError(t, err)
+    q, err := r.Query()
+    require.NoError(t, err)
+    assert.Equal(t, "go http", q.Get("q"))
+    assert.Equal(t, []string{"a", "b&c"}, q["tag"])
+    assert.True(t, q.Has("empty"))
+    assert.True(t, q.Has("flag"))
+    assert.False(t, q.Has("missing"))
+}
+
+func Test_Query_Invalid_Escape(t *testing.T) {
+    _, err := ParseQuery("a=1&b=%zz", 0)
+    assert.ErrorIs(t, err, ErrInvalidQuery)
+    assert.Contains(t, err.Error(), "%zz")
+
+    _, err = ParseQuery(strings.Repeat("a=1&", 5), 4)
+    assert.ErrorIs(t, err, ErrFormTooLarge)
+}
+
+func Test_Form(t *testing.T) {
+    body := "name=J%C3%BCrgen+S&lang=go&lang=c"
+    reader := &chunkReader{
+        data: "POST /submit HTTP/1.1\r\n" +
+            "Content-Type: application/x-www-form-urlencoded; charset=utf-8\r\n" +
+            "Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+            "\r\n" + body,
+        numBytesPerRead: 5,
+    }
+    r, err := RequestHeadFromReader(reader)
+    require.NoError(t, err)
+    f, err := r.Form()
+    require.NoError(t, err)
+    assert.Equal(t, "Jürgen S", f.Get("name"))
+    assert.Equal(t, []string{"go", "c"}, f["lang"])
+    assert.Equal(t, body, string(r.Body))
+
+    // Cached on repeated calls.
+    f2, err := r.Form()
+    require.NoError(t, err)
+    assert.Equal(t, f, f2)
+}
+
+func Test_Form_Other_Content_Type(t *testing.T) {
+    r, err := RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n\r\na=b"))
+    require.NoError(t, err)
+    f, err := r.Form()
+    require.NoError(t, err)
+    assert.Empty(t, f)
+    // The body is left for the handler.
+    body, err := r.ReadBody()
+    require.NoError(t, err)
+    assert.Equal(t, "a=b", string(body))
+}
+
+func Test_Form_Limits_And_Errors(t *testing.T) {
+    req := "POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 11\r\n\r\na=1&b=2&c=3"
+    r, err := NewReaderWithLimits(strings.NewReader(req), Limits{MaxFormBytes: 8}).ReadRequest()
+    require.NoError(t, err)
+    _, err = r.Form()
+    assert.ErrorIs(t, err, ErrFormTooLarge)
+
+    r, err = NewReaderWithLimits(strings.NewReader(req), Limits{MaxFormFields: 2}).ReadRequest()
+    require.NoError(t, err)
+    _, err = r.Form()
+    assert.ErrorIs(t, err, ErrFormTooLarge)
+
+    // The limit also applies to a body that was already read.
+    r, err = NewReaderWithLimits(strings.NewReader(req), Limits{MaxFormBytes: 8}).ReadRequest()
+    require.NoError(t, err)
+    _, err = r.ReadBody()
+    require.NoError(t, err)
+    _, err = r.Form()
+    assert.ErrorIs(t, err, ErrFormTooLarge)
+
+    // A body partly read through BodyReader cannot be parsed.
+    r, err = RequestHeadFromReader(strings.NewReader(req))
+    require.NoError(t, err)
+    _, err = io.ReadFull(r.BodyReader, make([]byte, 4))
+    require.NoError(t, err)
+    _, err = r.Form()
+    assert.ErrorIs(t, err, ErrBodyPartlyRead)
+
+    r, err = RequestHeadFromReader(strings.NewReader(req))
+    require.NoError(t, err)
+    _, err = io.ReadFull(r.BodyReader, make([]byte, 4))
+    require.NoError(t, err)
+    _, err = r.ReadBody()
+    require.NoError(t, err)
+    _, err = r.Form()
+    assert.ErrorIs(t, err, ErrBodyPartlyRead)
+
+    r, err = RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 5\r\n\r\na=%G1"))
+    require.NoError(t, err)
+    _, err = r.Form()
+    assert.ErrorIs(t, err, ErrInvalidForm)
+}
+
+// Expect: 100-continue tests
+func Test_Expect_Continue_Hook(t *testing.T) {
+    r, err := RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nExpect: 100-Continue\r\nContent-Length: 4\r\n\r\ndata"))
+    require.NoError(t, err)
+    assert.True(t, r.ExpectsContinue())
+    assert.True(t, r.HasBody())
+    calls := 0
+    r.OnBodyRead(func() error {
+        calls++
+        return nil
+    })
+    assert.Equal(t, 0, calls)
+    body, err := r.ReadBody()
+    require.NoError(t, err)
+    assert.Equal(t, "data", string(body))
+    assert.Equal(t, 1, calls)
+}
+
+func Test_Expect_Continue_Hook_Error(t *testing.T) {
+    r, err := RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\ndata"))
+    require.NoError(t, err)
+    r.OnBodyRead(func() error { return io.ErrClosedPipe })
+    _, err = r.ReadBody()
+    assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func Test_Expect_Continue_Not_Called_When_Drained(t *testing.T) {
+    cr := NewReader(strings.NewReader("POST / HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\ndataGET / HTTP/1.0\r\nExpect: 100-continue\r\n\r\n"))
+    r, err := cr.ReadRequest()
+    require.NoError(t, err)
+    r.OnBodyRead(func() error {
+        t.Fatal("hook called while draining")
+        return nil
+    })
+    r, err = cr.ReadRequest()
+    require.NoError(t, err)
+    assert.False(t, r.ExpectsContinue())
+    assert.False(t, r.HasBody())
+}
+
+// Header validation mode tests
+func Test_Header_Mode(t *testing.T) {
+    req := "GET / HTTP/1.1\r\nX-Long: part one\r\n part two\r\nHost: a\r\n\r\n"
+    _, err := NewReader(strings.NewReader(req)).ReadRequest()
+    assert.ErrorIs(t, err, headers.ErrObsFold)
+    var pe *ParseError
+    require.ErrorAs(t, err, &pe)
+    assert.Equal(t, 400, pe.StatusCode)
+
+    cr := NewReader(strings.NewReader(req))
+    cr.HeaderMode = headers.Lenient
+    r, err := cr.ReadRequest()
+    require.NoError(t, err)
+    assert.Equal(t, "part one part two", r.Headers.Get("X-Long"))
+    assert.Equal(t, "a", r.Headers.Get("Host"))
+
+    _, err = NewReader(strings.NewReader("GET / HTTP/1.1\r\nX-A: a\x00b\r\n\r\n")).ReadRequest()
+    assert.ErrorIs(t, err, headers.ErrInvalidValue)
+}
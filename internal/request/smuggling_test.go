@@ -0,0 +1,198 @@
+package request
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+// Request smuggling regression tests. Each payload is framed ambiguously in
+// a way that has been used to desynchronize servers on the same path.
+
+func Test_Smuggling_Rejected(t *testing.T) {
+    cases := []struct {
+        name   string
+        req    string
+        err    error
+        status int
+    }{
+        {"conflicting content-length lines",
+            "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!",
+            ErrConflictingLength, 400},
+        {"conflicting content-length list",
+            "POST / HTTP/1.1\r\nContent-Length: 5, 6\r\n\r\nhello!",
+            ErrConflictingLength, 400},
+        {"content-length with plus sign",
+            "POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello",
+            ErrInvalidContentLength, 400},
+        {"negative content-length",
+            "POST / HTTP/1.1\r\nContent-Length: -5\r\n\r\nhello",
+            ErrInvalidContentLength, 400},
+        {"hex content-length",
+            "POST / HTTP/1.1\r\nContent-Length: 0x5\r\n\r\nhello",
+            ErrInvalidContentLength, 400},
+        {"content-length with inner space",
+            "POST / HTTP/1.1\r\nContent-Length: 5 5\r\n\r\nhello",
+            ErrInvalidContentLength, 400},
+        {"empty content-length",
+            "POST / HTTP/1.1\r\nContent-Length:\r\n\r\n",
+            ErrInvalidContentLength, 400},
+        {"empty content-length list member",
+            "POST / HTTP/1.1\r\nContent-Length: 5,\r\n\r\nhello",
+            ErrInvalidContentLength, 400},
+        {"unknown transfer coding",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: xchunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+            ErrUnsupportedTransferCoding, 501},
+        {"compression before chunked",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n",
+            ErrUnsupportedTransferCoding, 501},
+        {"chunked twice",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n",
+            ErrInvalidTransferEncoding, 400},
+        {"chunked twice on separate lines",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+            ErrInvalidTransferEncoding, 400},
+        {"chunked not final",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n",
+            ErrInvalidTransferEncoding, 400},
+        {"chunked with parameter",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked;x=y\r\n\r\n0\r\n\r\n",
+            ErrInvalidTransferEncoding, 400},
+        {"empty transfer coding",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: ,chunked\r\n\r\n0\r\n\r\n",
+            ErrInvalidTransferEncoding, 400},
+        {"transfer-encoding in HTTP/1.0",
+            "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+            ErrInvalidTransferEncoding, 400},
+        {"space before colon",
+            "POST / HTTP/1.1\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n",
+            headers.ErrSpaceBeforeColon, 400},
+        {"obs-fold hides transfer-encoding",
+            "POST / HTTP/1.1\r\nHost: a\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+            headers.ErrObsFold, 400},
+        {"vertical tab in name",
+            "POST / HTTP/1.1\r\nTransfer-Encoding\x0b: chunked\r\n\r\n0\r\n\r\n",
+            headers.ErrInvalidKey, 400},
+        {"vertical tab in value",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: \x0bchunked\r\n\r\n0\r\n\r\n",
+            headers.ErrInvalidValue, 400},
+        {"hex prefix in chunk size",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0x5\r\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"negative chunk size",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n-1\r\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"leading space in chunk size",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n 5\r\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"chunk size overflow",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nffffffffffffffff1\r\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"chunk size overflow after leading zeros",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n000ffffffffffffffff\r\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"chunk data longer than size",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"bare LF in chunk line",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n",
+            ErrInvalidChunk, 400},
+        {"bare LF in request line",
+            "POST / HTTP/1.1\nContent-Length: 5\r\n\r\nhello",
+            ErrInvalidRequestLine, 400},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            _, err := RequestFromReader(strings.NewReader(tc.req))
+            var pe *ParseError
+            require.ErrorAs(t, err, &pe)
+            assert.ErrorIs(t, err, tc.err)
+            assert.Equal(t, tc.status, pe.StatusCode)
+        })
+    }
+}
+
+func Test_Smuggling_Lenient_Leading_Whitespace_Rejected(t *testing.T) {
+    // Lenient mode unfolds obs-fold, but a first header or trailer line
+    // that starts with whitespace has nothing to continue.
+    for _, req := range []string{
+        "POST / HTTP/1.1\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+        "POST / HTTP/1.1\r\n\tTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+        "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n Content-Length: 5\r\n\r\n",
+    } {
+        rd := NewReader(strings.NewReader(req))
+        rd.HeaderMode = headers.Lenient
+        r, err := rd.ReadRequest()
+        if err == nil {
+            _, err = r.ReadBody()
+        }
+        var pe *ParseError
+        require.ErrorAs(t, err, &pe, "%q", req)
+        assert.ErrorIs(t, err, headers.ErrObsFold)
+        assert.Equal(t, 400, pe.StatusCode)
+    }
+}
+
+func Test_Smuggling_Accepted(t *testing.T) {
+    cases := []struct {
+        name      string
+        req       string
+        body      string
+        keepAlive bool
+    }{
+        {"identical content-length lines",
+            "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+            "hello", true},
+        {"identical content-length list",
+            "POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\nhello",
+            "hello", true},
+        {"chunk size with leading zeros",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0000000000000000005\r\nhello\r\n00000000000000000000\r\n\r\n",
+            "hello", true},
+        {"chunked is case-insensitive",
+            "POST / HTTP/1.1\r\nTransfer-Encoding: CHUNKED\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+            "hello", true},
+        {"transfer-encoding overrides content-length",
+            "POST / HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+            "hello", false},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            r, err := RequestFromReader(strings.NewReader(tc.req))
+            require.NoError(t, err)
+            assert.Equal(t, tc.body, string(r.Body))
+            assert.Equal(t, tc.keepAlive, r.KeepAlive())
+        })
+    }
+}
+
+func Test_Smuggling_Content_Length_Removed(t *testing.T) {
+    r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+        "Content-Length: 3\r\n" +
+        "Transfer-Encoding: chunked\r\n" +
+        "\r\n" +
+        "5\r\nhello\r\n0\r\n\r\n"))
+    require.NoError(t, err)
+    assert.False(t, r.Headers.Has("Content-Length"))
+}
+
+func Test_Smuggling_CL_And_TE_Disables_Keep_Alive(t *testing.T) {
+    // The body of the first request holds a second request that a server
+    // honoring Content-Length would see. The connection must not be
+    // reused, so it is never parsed as one; see the server tests.
+    rd := NewReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+        "Content-Length: 4\r\n" +
+        "Transfer-Encoding: chunked\r\n" +
+        "\r\n" +
+        "0\r\n\r\n" +
+        "GET /admin HTTP/1.1\r\n\r\n"))
+    r, err := rd.ReadRequest()
+    require.NoError(t, err)
+    _, err = r.ReadBody()
+    require.NoError(t, err)
+    assert.False(t, r.KeepAlive())
+}
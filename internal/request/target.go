@@ -0,0 +1,266 @@
+package request
+
+import (
+    "fmt"
+    "strings"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 section 3.2.
+type TargetForm int
+
+const (
+    // OriginForm is an absolute path with an optional query: "/where?q=now".
+    OriginForm TargetForm = iota + 1
+    // AbsoluteForm is a full URI, as sent to proxies: "http://host/where".
+    AbsoluteForm
+    // AuthorityForm is host and port, used only with CONNECT: "host:443".
+    AuthorityForm
+    // AsteriskForm is "*", used only with OPTIONS.
+    AsteriskForm
+)
+
+// String returns the RFC name of the form.
+func (f TargetForm) String() string {
+    switch f {
+    case OriginForm:
+        return "origin-form"
+    case AbsoluteForm:
+        return "absolute-form"
+    case AuthorityForm:
+        return "authority-form"
+    case AsteriskForm:
+        return "asterisk-form"
+    default:
+        return "unknown"
+    }
+}
+
+// URL is a request-target parsed into its parts.
+type URL struct {
+    Form TargetForm
+    // Scheme is the lowercased scheme of an absolute-form target.
+    Scheme string
+    // Host is the authority (host and optional port) of an absolute-form
+    // or authority-form target.
+    Host string
+    // Path is the percent-decoded path. It is empty for the authority and
+    // asterisk forms.
+    Path string
+    // RawPath is the path exactly as sent, still percent-encoded.
+    RawPath string
+    // RawQuery is the query without the leading '?', still encoded.
+    RawQuery string
+}
+
+// parseTarget classifies and parses the request-target for method.
+func parseTarget(method, target string) (URL, error) {
+    if target == "" {
+        return URL{}, fmt.Errorf("%w: empty", ErrInvalidTarget)
+    }
+    if strings.IndexByte(target, '#') != -1 {
+        return URL{}, fmt.Errorf("%w: fragment not allowed", ErrInvalidTarget)
+    }
+    switch {
+    case target == "*":
+        if method != "OPTIONS" {
+            return URL{}, fmt.Errorf("%w: asterisk-form is only allowed with OPTIONS", ErrInvalidTarget)
+        }
+        return URL{Form: AsteriskForm}, nil
+    case method == "CONNECT":
+        if err := validateAuthority(target, true); err != nil {
+            return URL{}, err
+        }
+        return URL{Form: AuthorityForm, Host: target}, nil
+    case target[0] == '/':
+        u := URL{Form: OriginForm}
+        if err := u.setPathAndQuery(target); err != nil {
+            return URL{}, err
+        }
+        return u, nil
+    default:
+        return parseAbsoluteTarget(target)
+    }
+}
+
+// parseAbsoluteTarget parses an absolute-form target. Only the http and
+// https schemes are accepted.
+func parseAbsoluteTarget(target string) (URL, error) {
+    colon := strings.IndexByte(target, ':')
+    if colon <= 0 {
+        return URL{}, fmt.Errorf("%w: not an absolute path or URI", ErrInvalidTarget)
+    }
+    scheme := strings.ToLower(target[:colon])
+    if scheme != "http" && scheme != "https" {
+        return URL{}, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidTarget, scheme)
+    }
+    rest := target[colon+1:]
+    if !strings.HasPrefix(rest, "//") {
+        return URL{}, fmt.Errorf("%w: missing authority", ErrInvalidTarget)
+    }
+    rest = rest[2:]
+    end := strings.IndexAny(rest, "/?")
+    if end == -1 {
+        end = len(rest)
+    }
+    host := rest[:end]
+    if err := validateAuthority(host, false); err != nil {
+        return URL{}, err
+    }
+    u := URL{Form: AbsoluteForm, Scheme: scheme, Host: host}
+    pathAndQuery := rest[end:]
+    if pathAndQuery == "" || pathAndQuery[0] == '?' {
+        // An empty path in an http URI means "/".
+        pathAndQuery = "/" + pathAndQuery
+    }
+    if err := u.setPathAndQuery(pathAndQuery); err != nil {
+        return URL{}, err
+    }
+    return u, nil
+}
+
+// setPathAndQuery validates and stores "absolute-path [ ? query ]".
+func (u *URL) setPathAndQuery(s string) error {
+    rawPath, rawQuery, hasQuery := strings.Cut(s, "?")
+    for i := 0; i < len(rawPath); i++ {
+        c := rawPath[i]
+        if c != '/' && c != '%' && !isPathChar(c) {
+            return fmt.Errorf("%w: invalid character %q in path", ErrInvalidTarget, c)
+        }
+    }
+    for i := 0; i < len(rawQuery); i++ {
+        c := rawQuery[i]
+        if c != '/' && c != '?' && c != '%' && !isPathChar(c) {
+            return fmt.Errorf("%w: invalid character %q in query", ErrInvalidTarget, c)
+        }
+    }
+    path, err := unescape(rawPath, false)
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+    }
+    if hasQuery {
+        if _, err := unescape(rawQuery, false); err != nil {
+            return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+        }
+    }
+    u.Path = path
+    u.RawPath = rawPath
+    u.RawQuery = rawQuery
+    return nil
+}
+
+// validateAuthority checks "host [ : port ]". User information is not
+// allowed in http URIs. When portRequired is set the port must be present.
+func validateAuthority(s string, portRequired bool) error {
+    if s == "" {
+        return fmt.Errorf("%w: empty host", ErrInvalidTarget)
+    }
+    if strings.IndexByte(s, '@') != -1 {
+        return fmt.Errorf("%w: userinfo not allowed", ErrInvalidTarget)
+    }
+    host, port := s, ""
+    hasPort := false
+    if s[0] == '[' {
+        // IP-literal
+        end := strings.IndexByte(s, ']')
+        if end == -1 {
+            return fmt.Errorf("%w: unterminated IP literal", ErrInvalidTarget)
+        }
+        host = s[:end+1]
+        for i := 1; i < end; i++ {
+            c := s[i]
+            if !isHexDigit(c) && c != ':' && c != '.' {
+                return fmt.Errorf("%w: invalid IP literal", ErrInvalidTarget)
+            }
+        }
+        rest := s[end+1:]
+        if rest != "" {
+            if rest[0] != ':' {
+                return fmt.Errorf("%w: invalid authority", ErrInvalidTarget)
+            }
+            port, hasPort = rest[1:], true
+        }
+    } else {
+        if i := strings.LastIndexByte(s, ':'); i != -1 {
+            host, port, hasPort = s[:i], s[i+1:], true
+        }
+        if host == "" {
+            return fmt.Errorf("%w: empty host", ErrInvalidTarget)
+        }
+        for i := 0; i < len(host); i++ {
+            c := host[i]
+            if !isUnreserved(c) && !isSubDelim(c) && c != '%' {
+                return fmt.Errorf("%w: invalid character %q in host", ErrInvalidTarget, c)
+            }
+        }
+    }
+    if portRequired && (!hasPort || port == "") {
+        return fmt.Errorf("%w: port required", ErrInvalidTarget)
+    }
+    for i := 0; i < len(port); i++ {
+        if !isDigit(port[i]) {
+            return fmt.Errorf("%w: invalid port", ErrInvalidTarget)
+        }
+    }
+    return nil
+}
+
+// unescape decodes percent-encoded octets in s. If plusSpace is set, '+'
+// decodes to a space as in application/x-www-form-urlencoded data.
+func unescape(s string, plusSpace bool) (string, error) {
+    n := strings.Count(s, "%")
+    if n == 0 && (!plusSpace || strings.IndexByte(s, '+') == -1) {
+        return s, nil
+    }
+    var b strings.Builder
+    b.Grow(len(s) - 2*n)
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c == '+' && plusSpace {
+            b.WriteByte(' ')
+            continue
+        }
+        if c != '%' {
+            b.WriteByte(c)
+            continue
+        }
+        if i+2 >= len(s) || !isHexDigit(s[i+1]) || !isHexDigit(s[i+2]) {
+            end := min(i+3, len(s))
+            return "", fmt.Errorf("invalid percent-encoding %q", s[i:end])
+        }
+        b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+        i += 2
+    }
+    return b.String(), nil
+}
+
+// isPathChar reports whether c is a pchar other than a pct-encoded octet.
+func isPathChar(c byte) bool {
+    return isUnreserved(c) || isSubDelim(c) || c == ':' || c == '@'
+}
+
+func isUnreserved(c byte) bool {
+    switch {
+    case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+        return true
+    }
+    return c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isSubDelim(c byte) bool {
+    return strings.IndexByte("!$&'()*+,;=", c) != -1
+}
+
+func isHexDigit(c byte) bool {
+    return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+    switch {
+    case c >= '0' && c <= '9':
+        return c - '0'
+    case c >= 'a' && c <= 'f':
+        return c - 'a' + 10
+    default:
+        return c - 'A' + 10
+    }
+}
@@ -0,0 +1,35 @@
+package response
+
+import (
+    "sync"
+    "time"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+// clock returns the current time. Tests replace it.
+var clock = time.Now
+
+// dateCache holds the formatted Date value for the current second, so that
+// busy servers format it at most once per second.
+type dateCache struct {
+    mu    sync.Mutex
+    sec   int64
+    value string
+}
+
+// serverDate is the Date value shared by all responses.
+var serverDate dateCache
+
+// get returns the IMF-fixdate for the current second.
+func (c *dateCache) get() string {
+    now := clock()
+    sec := now.Unix()
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.value == "" || sec != c.sec {
+        c.sec = sec
+        c.value = headers.FormatTime(now)
+    }
+    return c.value
+}
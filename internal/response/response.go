@@ -1,95 +1,153 @@
 package response
 
 import (
+    "errors"
     "fmt"
     "io"
-    "sort"
+    "strconv"
 
     "github.com/xaitan80/httpfromtcp/internal/headers"
 )
 
-// StatusCode is a limited set of HTTP status codes we support.
-type StatusCode int
-
-const (
-    StatusOK                  StatusCode = 200
-    StatusBadRequest          StatusCode = 400
-    StatusInternalServerError StatusCode = 500
+// Errors returned when a body does not match the framing its headers
+// declared. Writing past a Content-Length, or chunked writes on a body
+// that is not chunked, would make the client misread the next response.
+var (
+    ErrInvalidContentLength = errors.New("invalid Content-Length")
+    ErrBodyTooLong          = errors.New("body longer than Content-Length")
+    ErrBodyTooShort         = errors.New("body shorter than Content-Length")
+    ErrBodyNotAllowed       = errors.New("response status does not allow a body")
+    ErrFramingMismatch      = errors.New("write does not match the declared framing")
+    ErrBodyDone             = errors.New("write after end of body")
 )
 
+// StatusCode is an HTTP status code. The registered codes and their
+// reason phrases are in status.go.
+type StatusCode int
+
 // WriteStatusLine writes the HTTP/1.1 status line for the given status code.
 func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-    var reason string
-    switch statusCode {
-    case StatusOK:
-        reason = "OK"
-    case StatusBadRequest:
-        reason = "Bad Request"
-    case StatusInternalServerError:
-        reason = "Internal Server Error"
-    default:
-        reason = ""
+    return WriteStatusLineVersion(w, "1.1", statusCode)
+}
+
+// WriteStatusLineVersion writes the status line for the given status code
+// using the given HTTP version, such as "1.0" or "1.1". The reason phrase
+// is the registered one, or empty for an unregistered code.
+func WriteStatusLineVersion(w io.Writer, version string, statusCode StatusCode) error {
+    return WriteStatusLineReason(w, version, statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason
+// phrase. The reason may be empty; clients ignore it either way. It
+// returns ErrInvalidStatusCode for a code outside 100–599 and
+// ErrInvalidReasonPhrase if reason contains CR, LF or other control bytes.
+func WriteStatusLineReason(w io.Writer, version string, statusCode StatusCode, reason string) error {
+    if !statusCode.Valid() {
+        return fmt.Errorf("%w: %d", ErrInvalidStatusCode, int(statusCode))
     }
-    if reason == "" {
-        _, err := fmt.Fprintf(w, "HTTP/1.1 %d\r\n", int(statusCode))
-        return err
+    if !validReasonPhrase(reason) {
+        return fmt.Errorf("%w: %q", ErrInvalidReasonPhrase, reason)
     }
-    _, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", int(statusCode), reason)
+    // The space after the code is required even when the reason is empty.
+    _, err := fmt.Fprintf(w, "HTTP/%s %d %s\r\n", version, int(statusCode), reason)
     return err
 }
 
-// GetDefaultHeaders returns the default headers for our responses.
-func GetDefaultHeaders(contentLen int) headers.Headers {
+// GetDefaultHeaders returns the default headers for our responses,
+// including the current Date.
+func GetDefaultHeaders(contentLen int) *headers.Headers {
     h := headers.NewHeaders()
     // Use canonical case for response header keys
-    h["Content-Length"] = fmt.Sprintf("%d", contentLen)
-    h["Connection"] = "close"
-    h["Content-Type"] = "text/plain"
+    h.Set("Content-Length", fmt.Sprintf("%d", contentLen))
+    h.Set("Content-Type", "text/plain")
+    h.Set("Date", serverDate.get())
     return h
 }
 
-// WriteHeaders writes headers as "Key: Value\r\n" lines and a final CRLF.
-func WriteHeaders(w io.Writer, h headers.Headers) error {
+// WriteHeaders writes headers as "Key: Value\r\n" lines and a final CRLF,
+// in the order the field lines were added and with their names as stored.
+func WriteHeaders(w io.Writer, h *headers.Headers) error {
     return writeHeadersInternal(w, h)
 }
 
 // writeHeadersInternal renders headers and final CRLF.
-func writeHeadersInternal(w io.Writer, h headers.Headers) error {
-    // Preferred order for our default headers
-    order := []string{"Content-Length", "Connection", "Content-Type"}
-    written := make(map[string]struct{}, len(h))
-    for _, k := range order {
-        if v, ok := h[k]; ok {
-            if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, v); err != nil {
-                return err
-            }
-            written[k] = struct{}{}
-        }
-    }
-    // Write any remaining headers in sorted order
-    var rest []string
-    for k := range h {
-        if _, ok := written[k]; !ok {
-            rest = append(rest, k)
-        }
-    }
-    sort.Strings(rest)
-    for _, k := range rest {
-        if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, h[k]); err != nil {
-            return err
-        }
+func writeHeadersInternal(w io.Writer, h *headers.Headers) error {
+    if err := validateFields(h); err != nil {
+        return err
+    }
+    if err := writeFieldLines(w, h); err != nil {
+        return err
     }
     // End of headers
     _, err := io.WriteString(w, "\r\n")
     return err
 }
 
+// validateFields rejects names and values that would corrupt the message,
+// such as values containing CR or LF, before anything is written.
+func validateFields(h *headers.Headers) error {
+    for _, f := range h.Fields() {
+        if !headers.ValidFieldName(f.Name) {
+            return fmt.Errorf("invalid header field name %q", f.Name)
+        }
+        if !headers.ValidFieldValue(f.Value) {
+            return fmt.Errorf("invalid value for header field %q", f.Name)
+        }
+    }
+    return nil
+}
+
+// writeFieldLines writes one "Key: Value\r\n" line per field line, in order.
+func writeFieldLines(w io.Writer, h *headers.Headers) error {
+    for _, f := range h.Fields() {
+        if _, err := fmt.Fprintf(w, "%s: %s\r\n", f.Name, f.Value); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
 // Writer enforces ordered writing of status line, headers, then body.
 type Writer struct {
     w     io.Writer
     state writerState
+    // version is the HTTP version written in the status line.
+    version string
+    // wantKeepAlive is whether the client asked for a persistent connection.
+    wantKeepAlive bool
+    // closeAfter is set once the written headers require closing the
+    // connection after the response.
+    closeAfter bool
+    // rawChunks is set when chunked writes must be sent unencoded because
+    // the client does not understand chunked transfer coding.
+    rawChunks bool
+    // status is the final status code written.
+    status StatusCode
+    // pending holds headers that declared no framing. They are sent, with
+    // a Content-Length or chunked coding, once the body is known to be
+    // small or large.
+    pending *headers.Headers
+    // buf holds the body while headers are pending.
+    buf []byte
+    // bufferSize is how much body is buffered before switching to chunked.
+    bufferSize int
+    // chunked is set once chunked headers have been sent.
+    chunked bool
+    // done is set once the body has been terminated.
+    done bool
+    // rw is the io.Writer view returned by ResponseWriter, if requested.
+    rw *ResponseWriter
+    // remaining is how much of a declared Content-Length is left to
+    // write, or -1 if the body is chunked or delimited by closing.
+    remaining int64
+    // head is set for a response to a HEAD request, which has no body.
+    head bool
 }
 
+// defaultBufferSize is the largest body sent with an automatic
+// Content-Length. Larger bodies are sent chunked.
+const defaultBufferSize = 4 << 10
+
 type writerState int
 
 const (
@@ -100,99 +158,446 @@ const (
 )
 
 // NewWriter wraps an io.Writer with ordered response writing.
-func NewWriter(w io.Writer) *Writer { return &Writer{w: w, state: writerStateInit} }
+func NewWriter(w io.Writer) *Writer {
+    return &Writer{w: w, state: writerStateInit, version: "1.1", wantKeepAlive: true, bufferSize: defaultBufferSize, remaining: -1}
+}
+
+// SetProtocol configures the response for the request it answers: version
+// is the request's HTTP version and keepAlive whether the client asked to
+// keep the connection open. It must be called before WriteStatusLine.
+// HTTP/1.0 responses are answered as HTTP/1.0 and never use chunked coding.
+func (wr *Writer) SetProtocol(version string, keepAlive bool) {
+    if version == "1.0" {
+        wr.version = "1.0"
+    } else {
+        wr.version = "1.1"
+    }
+    wr.wantKeepAlive = keepAlive
+}
+
+// SetMethod records the method of the request being answered. For HEAD,
+// the headers are sent as they would be for GET but any body written is
+// discarded. It must be called before WriteHeaders.
+func (wr *Writer) SetMethod(method string) {
+    wr.head = method == "HEAD"
+}
+
+// KeepAlive reports whether the connection may be reused after the
+// response. It is only meaningful once the headers have been written.
+func (wr *Writer) KeepAlive() bool {
+    return wr.state >= writerStateHeaders && !wr.closeAfter
+}
 
 // WriteStatusLine writes the HTTP status line. Must be first.
 func (wr *Writer) WriteStatusLine(statusCode StatusCode) error {
+    return wr.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the HTTP status line with a custom reason
+// phrase, such as one mirrored from an upstream server. Must be first.
+func (wr *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
     if wr.state != writerStateInit {
         return fmt.Errorf("invalid write order: status already written")
     }
-    if err := WriteStatusLine(wr.w, statusCode); err != nil {
+    if err := WriteStatusLineReason(wr.w, wr.version, statusCode, reason); err != nil {
         return err
     }
+    wr.status = statusCode
     wr.state = writerStateStatus
     return nil
 }
 
-// WriteHeaders writes headers after the status line.
-func (wr *Writer) WriteHeaders(h headers.Headers) error {
+// WriteInterim writes an informational (1xx) response, such as
+// 100 Continue, before the final response. h may be nil. It is only
+// allowed before the final status line, and is skipped for HTTP/1.0
+// clients, which do not understand interim responses.
+func (wr *Writer) WriteInterim(statusCode StatusCode, h *headers.Headers) error {
+    if wr.state != writerStateInit {
+        return fmt.Errorf("invalid write order: interim response after status")
+    }
+    if statusCode < 100 || statusCode > 199 || statusCode == 101 {
+        return fmt.Errorf("invalid interim status code %d", int(statusCode))
+    }
+    if wr.version == "1.0" {
+        return nil
+    }
+    if err := validateFields(h); err != nil {
+        return err
+    }
+    if err := WriteStatusLineVersion(wr.w, wr.version, statusCode); err != nil {
+        return err
+    }
+    if h == nil {
+        h = headers.NewHeaders()
+    }
+    return writeHeadersInternal(wr.w, h)
+}
+
+// WriteHeaders writes headers after the status line. A Date field is
+// added unless h already has one.
+//
+// If h declares neither Content-Length nor Transfer-Encoding, the writer
+// frames the body itself: the headers are held back while the body is
+// buffered, then sent with a Content-Length when the response finishes,
+// or with chunked coding once the body outgrows the buffer or is flushed.
+func (wr *Writer) WriteHeaders(h *headers.Headers) error {
     if wr.state != writerStateStatus {
         return fmt.Errorf("invalid write order: headers before status or after body")
     }
-    if err := writeHeadersInternal(wr.w, h); err != nil {
+    if err := checkHeaders(h); err != nil {
+        return err
+    }
+    if !h.Has("Content-Length") && !h.Has("Transfer-Encoding") && bodyAllowed(wr.status) {
+        wr.pending = h.Clone()
+        if wr.pending == nil {
+            wr.pending = headers.NewHeaders()
+        }
+        wr.state = writerStateHeaders
+        return nil
+    }
+    if err := wr.sendHeaders(h); err != nil {
         return err
     }
     wr.state = writerStateHeaders
     return nil
 }
 
-// WriteBody writes response body. Must be after headers.
-func (wr *Writer) WriteBody(p []byte) (int, error) {
+// checkHeaders returns the error WriteHeaders would return for h without
+// writing anything, so that a status line is never sent with headers
+// that cannot follow it.
+func checkHeaders(h *headers.Headers) error {
+    if err := validateFields(h); err != nil {
+        return err
+    }
+    if h.Has("Content-Length") && !h.Has("Transfer-Encoding") {
+        if _, err := parseContentLength(h.Get("Content-Length")); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// parseContentLength parses a Content-Length value set by a handler.
+func parseContentLength(v string) (int64, error) {
+    n, err := strconv.ParseInt(v, 10, 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, v)
+    }
+    return n, nil
+}
+
+// sendHeaders negotiates and writes h, and records the body length it
+// declares.
+func (wr *Writer) sendHeaders(h *headers.Headers) error {
+    out := wr.negotiateHeaders(h)
+    wr.remaining = -1
+    if !wr.chunked && !wr.rawChunks && out.Has("Content-Length") {
+        n, err := parseContentLength(out.Get("Content-Length"))
+        if err != nil {
+            return err
+        }
+        wr.remaining = n
+    }
+    if !bodyAllowed(wr.status) {
+        wr.remaining = 0
+    }
+    return writeHeadersInternal(wr.w, out)
+}
+
+// bodyAllowed reports whether a response with status code may have a body.
+func bodyAllowed(code StatusCode) bool {
+    return code >= 200 && code != StatusNoContent && code != StatusNotModified
+}
+
+// negotiateHeaders adds the Date field and adjusts the connection and
+// framing headers in a copy of h for the protocol set with SetProtocol,
+// and records whether the connection must be closed after the response.
+func (wr *Writer) negotiateHeaders(h *headers.Headers) *headers.Headers {
+    out := h.Clone()
+    if out == nil {
+        out = headers.NewHeaders()
+    }
+    if !out.Has("Date") {
+        out.Set("Date", serverDate.get())
+    }
+    chunked := headers.ContainsToken(out.Get("Transfer-Encoding"), "chunked")
+    hasLength := out.Has("Content-Length") || !bodyAllowed(wr.status)
+    if chunked && wr.version == "1.0" {
+        // HTTP/1.0 clients cannot decode chunks: send the raw body and
+        // delimit it by closing the connection.
+        out.Del("Transfer-Encoding")
+        out.Del("Trailer")
+        wr.rawChunks = true
+        chunked = false
+    }
+    wr.chunked = chunked
+
+    conn, hasConn := out.Get("Connection"), out.Has("Connection")
+    wr.closeAfter = !wr.wantKeepAlive || headers.ContainsToken(conn, "close") || !chunked && !hasLength
+    if wr.version == "1.0" && hasConn && !headers.ContainsToken(conn, "keep-alive") {
+        wr.closeAfter = true
+    }
+    if !hasConn {
+        // Make the decision explicit where it differs from the version's default.
+        if wr.version == "1.0" && !wr.closeAfter {
+            out.Set("Connection", "keep-alive")
+        }
+        if wr.version == "1.1" && wr.closeAfter {
+            out.Set("Connection", "close")
+        }
+    }
+    return out
+}
+
+// Write writes p as part of the response body, encoded for the framing
+// the headers declared: as a chunk when the body is chunked, as is
+// otherwise. Must be after headers. With a declared Content-Length, only
+// the bytes that fit are written and ErrBodyTooLong is returned for the
+// rest. A response to a HEAD request accepts and discards the body; one
+// whose status has no body (1xx, 204 or 304) rejects it with
+// ErrBodyNotAllowed.
+func (wr *Writer) Write(p []byte) (int, error) {
     if wr.state != writerStateHeaders && wr.state != writerStateBody {
         return 0, fmt.Errorf("invalid write order: body before headers")
     }
+    if wr.done {
+        return 0, ErrBodyDone
+    }
     wr.state = writerStateBody
-    return wr.w.Write(p)
+    if wr.pending != nil {
+        if len(wr.buf)+len(p) <= wr.bufferSize {
+            wr.buf = append(wr.buf, p...)
+            return len(p), nil
+        }
+        if err := wr.commitChunked(); err != nil {
+            return 0, err
+        }
+    }
+    switch {
+    case wr.chunked:
+        return wr.writeChunk(p)
+    case wr.remaining < 0:
+        return wr.writeRaw(p)
+    case !bodyAllowed(wr.status):
+        if len(p) == 0 {
+            return 0, nil
+        }
+        return 0, fmt.Errorf("%w: status %d", ErrBodyNotAllowed, int(wr.status))
+    case int64(len(p)) > wr.remaining:
+        n, err := wr.writeRaw(p[:wr.remaining])
+        wr.remaining -= int64(n)
+        if err != nil {
+            return n, err
+        }
+        return n, fmt.Errorf("%w: %d bytes over Content-Length", ErrBodyTooLong, len(p)-n)
+    default:
+        n, err := wr.writeRaw(p)
+        wr.remaining -= int64(n)
+        return n, err
+    }
+}
+
+// WriteBody writes response body. It is the same as Write.
+func (wr *Writer) WriteBody(p []byte) (int, error) {
+    return wr.Write(p)
+}
+
+// Flush sends any buffered body, switching to chunked coding if the
+// headers are still pending, and flushes the underlying writer if it
+// supports it.
+func (wr *Writer) Flush() error {
+    if wr.state != writerStateHeaders && wr.state != writerStateBody {
+        return fmt.Errorf("invalid write order: flush before headers")
+    }
+    if wr.pending != nil {
+        if err := wr.commitChunked(); err != nil {
+            return err
+        }
+    }
+    if f, ok := wr.w.(interface{ Flush() error }); ok {
+        return f.Flush()
+    }
+    return nil
+}
+
+// Finish completes the response: it sends pending headers with a
+// Content-Length for the buffered body, or terminates a chunked body
+// that was not terminated. If the handler only set headers through
+// ResponseWriter, they are sent with a 200 status. It must be called once
+// the handler is done and is a no-op when the response is already complete.
+//
+// If fewer bytes were written than the declared Content-Length, the
+// response cannot be completed: Finish returns ErrBodyTooShort and the
+// connection must be closed, so the client sees a truncated message
+// rather than one that runs into the next response. Finish also fails
+// if a status line was written without headers.
+func (wr *Writer) Finish() error {
+    if wr.state == writerStateInit && wr.rw != nil {
+        if err := wr.rw.finish(); err != nil {
+            return err
+        }
+    }
+    if wr.state == writerStateStatus {
+        wr.closeAfter = true
+        return fmt.Errorf("invalid write order: finish before headers")
+    }
+    if wr.state == writerStateInit || wr.done {
+        return nil
+    }
+    wr.done = true
+    if wr.pending != nil {
+        h := wr.pending
+        wr.pending = nil
+        h.Set("Content-Length", strconv.Itoa(len(wr.buf)))
+        if err := wr.sendHeaders(h); err != nil {
+            return err
+        }
+        _, err := wr.writeRaw(wr.buf)
+        wr.buf = nil
+        wr.remaining = 0
+        return err
+    }
+    if wr.chunked {
+        _, err := wr.writeRaw([]byte("0\r\n\r\n"))
+        return err
+    }
+    if wr.remaining > 0 && !wr.head && bodyAllowed(wr.status) {
+        wr.closeAfter = true
+        return fmt.Errorf("%w: %d bytes missing", ErrBodyTooShort, wr.remaining)
+    }
+    return nil
+}
+
+// commitChunked sends the pending headers with chunked coding, followed
+// by the buffered body as the first chunk.
+func (wr *Writer) commitChunked() error {
+    h := wr.pending
+    wr.pending = nil
+    h.Set("Transfer-Encoding", "chunked")
+    if err := wr.sendHeaders(h); err != nil {
+        return err
+    }
+    buf := wr.buf
+    wr.buf = nil
+    if len(buf) == 0 {
+        return nil
+    }
+    if !wr.chunked {
+        _, err := wr.writeRaw(buf)
+        return err
+    }
+    _, err := wr.writeChunk(buf)
+    return err
 }
 
 // WroteAnything returns true if any part of the response has been written.
 func (wr *Writer) WroteAnything() bool { return wr.state != writerStateInit }
 
 // WriteChunkedBody writes a single chunk encoded as: <hex>\r\n<data>\r\n
+// It returns ErrFramingMismatch if the headers declared a Content-Length.
 func (wr *Writer) WriteChunkedBody(p []byte) (int, error) {
+    if err := wr.startChunked(); err != nil {
+        return 0, err
+    }
+    if wr.rawChunks {
+        return wr.writeRaw(p)
+    }
+    return wr.writeChunk(p)
+}
+
+// startChunked checks that a chunked body may be written and sends any
+// pending headers with chunked coding.
+func (wr *Writer) startChunked() error {
     if wr.state != writerStateHeaders && wr.state != writerStateBody {
-        return 0, fmt.Errorf("invalid write order: body before headers")
+        return fmt.Errorf("invalid write order: body before headers")
+    }
+    if wr.done {
+        return ErrBodyDone
     }
     wr.state = writerStateBody
+    if wr.pending != nil {
+        if err := wr.commitChunked(); err != nil {
+            return err
+        }
+    }
+    if !wr.chunked && !wr.rawChunks {
+        return fmt.Errorf("%w: chunked write without chunked transfer coding", ErrFramingMismatch)
+    }
+    return nil
+}
+
+// writeChunk writes p as one chunk. An empty p writes nothing, since a
+// zero-size chunk would end the body.
+func (wr *Writer) writeChunk(p []byte) (int, error) {
+    if len(p) == 0 {
+        return 0, nil
+    }
+    if wr.head {
+        return len(p), nil
+    }
     // chunk size in hex followed by CRLF
-    if _, err := fmt.Fprintf(wr.w, "%x\r\n", len(p)); err != nil {
+    if _, err := wr.writeRaw(fmt.Appendf(nil, "%x\r\n", len(p))); err != nil {
         return 0, err
     }
     // chunk data
-    if len(p) > 0 {
-        if _, err := wr.w.Write(p); err != nil {
-            return 0, err
-        }
+    if _, err := wr.writeRaw(p); err != nil {
+        return 0, err
     }
     // terminating CRLF for this chunk
-    if _, err := io.WriteString(wr.w, "\r\n"); err != nil {
+    if _, err := wr.writeRaw([]byte("\r\n")); err != nil {
         return 0, err
     }
     return len(p), nil
 }
 
+// writeRaw writes p to the connection, or discards it for a HEAD
+// request. After a failed write the connection cannot be reused.
+func (wr *Writer) writeRaw(p []byte) (int, error) {
+    if wr.head {
+        return len(p), nil
+    }
+    n, err := wr.w.Write(p)
+    if err != nil {
+        wr.closeAfter = true
+    }
+    return n, err
+}
+
 // WriteChunkedBodyDone writes the terminating zero-size chunk: 0\r\n\r\n
 func (wr *Writer) WriteChunkedBodyDone() (int, error) {
-    if wr.state != writerStateHeaders && wr.state != writerStateBody {
-        return 0, fmt.Errorf("invalid write order: body before headers")
+    if err := wr.startChunked(); err != nil {
+        return 0, err
     }
-    wr.state = writerStateBody
-    n, err := io.WriteString(wr.w, "0\r\n\r\n")
-    return n, err
+    wr.done = true
+    if wr.rawChunks {
+        return 0, nil
+    }
+    return wr.writeRaw([]byte("0\r\n\r\n"))
 }
 
 // WriteTrailers writes the terminating zero-size chunk followed by trailer headers and a final CRLF.
-func (wr *Writer) WriteTrailers(h headers.Headers) error {
-    if wr.state != writerStateHeaders && wr.state != writerStateBody {
-        return fmt.Errorf("invalid write order: trailers before headers")
+func (wr *Writer) WriteTrailers(h *headers.Headers) error {
+    if err := wr.startChunked(); err != nil {
+        return err
     }
-    wr.state = writerStateBody
-    // zero-size chunk
-    if _, err := io.WriteString(wr.w, "0\r\n"); err != nil {
+    if err := validateFields(h); err != nil {
         return err
     }
-    // Write provided trailer headers (sorted for stability)
-    keys := make([]string, 0, len(h))
-    for k := range h {
-        keys = append(keys, k)
+    wr.done = true
+    if wr.rawChunks || wr.head {
+        // Trailers cannot be sent without chunked coding.
+        return nil
     }
-    sort.Strings(keys)
-    for _, k := range keys {
-        if _, err := fmt.Fprintf(wr.w, "%s: %s\r\n", k, h[k]); err != nil {
-            return err
-        }
+    // zero-size chunk
+    if _, err := wr.writeRaw([]byte("0\r\n")); err != nil {
+        return err
+    }
+    // Write provided trailer headers in order
+    if err := writeFieldLines(wr.w, h); err != nil {
+        wr.closeAfter = true
+        return err
     }
     // End of trailers
-    _, err := io.WriteString(wr.w, "\r\n")
+    _, err := wr.writeRaw([]byte("\r\n"))
     return err
 }
@@ -0,0 +1,548 @@
+package response
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+// testDate is the Date value written while the tests run.
+const testDate = "Sun, 06 Nov 1994 08:49:37 GMT"
+
+func TestMain(m *testing.M) {
+    clock = func() time.Time { return time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC) }
+    os.Exit(m.Run())
+}
+
+func Test_Write_Status_Line_Version(t *testing.T) {
+    var buf bytes.Buffer
+    require.NoError(t, WriteStatusLine(&buf, StatusOK))
+    assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+
+    buf.Reset()
+    require.NoError(t, WriteStatusLineVersion(&buf, "1.0", StatusBadRequest))
+    assert.Equal(t, "HTTP/1.0 400 Bad Request\r\n", buf.String())
+}
+
+func Test_Status_Text(t *testing.T) {
+    assert.Equal(t, "Not Found", StatusText(StatusNotFound))
+    assert.Equal(t, "", StatusText(418))
+    assert.Equal(t, "Unprocessable Content", StatusText(StatusUnprocessableContent))
+    assert.Equal(t, "Network Authentication Required", StatusText(StatusNetworkAuthenticationRequired))
+    assert.Equal(t, "", StatusText(299))
+    assert.Equal(t, "503 Service Unavailable", StatusServiceUnavailable.String())
+    assert.Equal(t, "299", StatusCode(299).String())
+}
+
+func Test_Write_Status_Line_Registered_And_Unregistered(t *testing.T) {
+    var buf bytes.Buffer
+    require.NoError(t, WriteStatusLine(&buf, StatusPermanentRedirect))
+    assert.Equal(t, "HTTP/1.1 308 Permanent Redirect\r\n", buf.String())
+
+    // An unregistered code keeps the space before the empty reason.
+    buf.Reset()
+    require.NoError(t, WriteStatusLine(&buf, 299))
+    assert.Equal(t, "HTTP/1.1 299 \r\n", buf.String())
+}
+
+func Test_Write_Status_Line_Custom_Reason(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLineReason(StatusOK, "Everything Is Fine"))
+    assert.Equal(t, "HTTP/1.1 200 Everything Is Fine\r\n", buf.String())
+
+    buf.Reset()
+    err := WriteStatusLineReason(&buf, "1.1", StatusOK, "OK\r\nSet-Cookie: a=b")
+    assert.ErrorIs(t, err, ErrInvalidReasonPhrase)
+    assert.Empty(t, buf.String())
+}
+
+func Test_Write_Status_Line_Rejects_Out_Of_Range(t *testing.T) {
+    for _, code := range []StatusCode{0, 99, 600, 1000, -200} {
+        var buf bytes.Buffer
+        w := NewWriter(&buf)
+        assert.ErrorIs(t, w.WriteStatusLine(code), ErrInvalidStatusCode, "code %d", int(code))
+        assert.Empty(t, buf.String())
+        assert.False(t, w.WroteAnything())
+    }
+}
+
+func Test_HTTP10_Chunked_Response_Sent_Raw(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.SetProtocol("1.0", true)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Transfer-Encoding", "chunked")
+    h.Set("Trailer", "X-Sum")
+    require.NoError(t, w.WriteHeaders(h))
+    _, err := w.WriteChunkedBody([]byte("hello "))
+    require.NoError(t, err)
+    _, err = w.WriteChunkedBody([]byte("world"))
+    require.NoError(t, err)
+    tr := headers.NewHeaders()
+    tr.Set("X-Sum", "abc")
+    require.NoError(t, w.WriteTrailers(tr))
+
+    assert.Equal(t, "HTTP/1.0 200 OK\r\nDate: " + testDate + "\r\n\r\nhello world", buf.String())
+    assert.False(t, w.KeepAlive())
+    // The caller's headers are left untouched.
+    assert.Equal(t, []string{"chunked"}, h.Values("Transfer-Encoding"))
+}
+
+func Test_HTTP10_Keep_Alive_Response(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.SetProtocol("1.0", true)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", "2")
+    require.NoError(t, w.WriteHeaders(h))
+    assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\nDate: " + testDate + "\r\nConnection: keep-alive\r\n\r\n", buf.String())
+    assert.True(t, w.KeepAlive())
+
+    // Without the client asking, an HTTP/1.0 connection is closed.
+    buf.Reset()
+    w = NewWriter(&buf)
+    w.SetProtocol("1.0", false)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    require.NoError(t, w.WriteHeaders(h))
+    assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\nDate: " + testDate + "\r\n\r\n", buf.String())
+    assert.False(t, w.KeepAlive())
+}
+
+func Test_HTTP11_Close_Requested(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.SetProtocol("1.1", false)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", "0")
+    require.NoError(t, w.WriteHeaders(h))
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nDate: " + testDate + "\r\nConnection: close\r\n\r\n", buf.String())
+    assert.False(t, w.KeepAlive())
+}
+
+func Test_Write_Interim_Continue(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteInterim(StatusContinue, nil))
+    assert.False(t, w.WroteAnything())
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+    assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\nDate: " + testDate + "\r\n\r\n", buf.String())
+
+    // Not after the final status line, and not for non-1xx codes.
+    assert.Error(t, w.WriteInterim(StatusContinue, nil))
+    assert.Error(t, NewWriter(&buf).WriteInterim(StatusOK, nil))
+
+    // HTTP/1.0 clients never see interim responses.
+    buf.Reset()
+    w = NewWriter(&buf)
+    w.SetProtocol("1.0", false)
+    require.NoError(t, w.WriteInterim(StatusContinue, nil))
+    assert.Empty(t, buf.String())
+}
+
+func Test_Write_Headers_Multiple_Values(t *testing.T) {
+    var buf bytes.Buffer
+    h := headers.NewHeaders()
+    h.Add("Set-Cookie", "a=1")
+    h.Add("Set-Cookie", "b=2")
+    h.Set("Content-Length", "0")
+    require.NoError(t, WriteHeaders(&buf, h))
+    assert.Equal(t, "Set-Cookie: a=1\r\nSet-Cookie: b=2\r\nContent-Length: 0\r\n\r\n", buf.String())
+}
+
+func Test_Write_Headers_Canonical_Keys(t *testing.T) {
+    var buf bytes.Buffer
+    h := headers.NewHeaders()
+    h.Set("content-type", "text/plain")
+    h.Set("x-request-id", "42")
+    require.NoError(t, WriteHeaders(&buf, h))
+    assert.Equal(t, "Content-Type: text/plain\r\nX-Request-Id: 42\r\n\r\n", buf.String())
+}
+
+func Test_Write_Headers_Rejects_Injection(t *testing.T) {
+    var buf bytes.Buffer
+    h := headers.NewHeaders()
+    h.Set("Location", "/ok\r\nSet-Cookie: evil=1")
+    assert.Error(t, WriteHeaders(&buf, h))
+    assert.Empty(t, buf.String())
+
+    h = headers.NewHeaders()
+    h.Add("Bad Name", "v")
+    assert.Error(t, WriteHeaders(&buf, h))
+}
+
+func Test_Write_Headers_Keeps_Wire_Order(t *testing.T) {
+    h := headers.NewHeaders()
+    data := []byte("x-Trace: 1\r\nHOST: example.com\r\nAccept: */*\r\nx-trace: 2\r\n\r\n")
+    for {
+        n, done, err := h.Parse(data)
+        require.NoError(t, err)
+        data = data[n:]
+        if done {
+            break
+        }
+    }
+    var buf bytes.Buffer
+    require.NoError(t, WriteHeaders(&buf, h))
+    assert.Equal(t, "x-Trace: 1\r\nHOST: example.com\r\nAccept: */*\r\nx-trace: 2\r\n\r\n", buf.String())
+}
+
+func Test_Writer_Set_Cookie(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", "0")
+    require.NoError(t, h.AddCookie(&headers.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true}))
+    require.NoError(t, h.AddCookie(&headers.Cookie{Name: "theme", Value: "dark"}))
+    require.NoError(t, w.WriteHeaders(h))
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nSet-Cookie: session=abc; Path=/; HttpOnly\r\nSet-Cookie: theme=dark\r\nDate: " + testDate + "\r\n\r\n", buf.String())
+}
+
+func Test_Date_Header(t *testing.T) {
+    // A Date set by the handler is kept.
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Date", "Mon, 07 Nov 1994 08:49:37 GMT")
+    h.Set("Content-Length", "0")
+    require.NoError(t, w.WriteHeaders(h))
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nDate: Mon, 07 Nov 1994 08:49:37 GMT\r\nContent-Length: 0\r\n\r\n", buf.String())
+
+    // The value is reformatted only when the second changes.
+    var c dateCache
+    now := time.Date(2024, 2, 29, 23, 59, 59, 100, time.UTC)
+    defer func(prev func() time.Time) { clock = prev }(clock)
+    clock = func() time.Time { return now }
+    assert.Equal(t, "Thu, 29 Feb 2024 23:59:59 GMT", c.get())
+    now = now.Add(500 * time.Millisecond)
+    assert.Equal(t, "Thu, 29 Feb 2024 23:59:59 GMT", c.get())
+    now = now.Add(time.Second)
+    assert.Equal(t, "Fri, 01 Mar 2024 00:00:00 GMT", c.get())
+}
+
+func Test_Auto_Framing_Small_Body_Gets_Content_Length(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Type", "text/plain")
+    require.NoError(t, w.WriteHeaders(h))
+    _, err := w.Write([]byte("hello "))
+    require.NoError(t, err)
+    _, err = w.Write([]byte("world"))
+    require.NoError(t, err)
+    // Only the status line is sent until the body is known.
+    assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+
+    require.NoError(t, w.Finish())
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 11\r\nDate: " + testDate + "\r\n\r\nhello world", buf.String())
+    assert.True(t, w.KeepAlive())
+    // Finishing twice writes nothing more.
+    n := buf.Len()
+    require.NoError(t, w.Finish())
+    assert.Equal(t, n, buf.Len())
+}
+
+func Test_Auto_Framing_Large_Body_Switches_To_Chunked(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.bufferSize = 8
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    require.NoError(t, w.WriteHeaders(nil))
+    _, err := w.Write([]byte("hello"))
+    require.NoError(t, err)
+    _, err = w.Write([]byte(" world"))
+    require.NoError(t, err)
+    _, err = w.Write([]byte("!"))
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nDate: " + testDate + "\r\n\r\n5\r\nhello\r\n6\r\n world\r\n1\r\n!\r\n0\r\n\r\n", buf.String())
+    assert.True(t, w.KeepAlive())
+}
+
+func Test_Auto_Framing_Flush_Switches_To_Chunked(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    require.NoError(t, w.WriteHeaders(nil))
+    _, err := w.Write([]byte("event"))
+    require.NoError(t, err)
+    require.NoError(t, w.Flush())
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nDate: " + testDate + "\r\n\r\n5\r\nevent\r\n", buf.String())
+
+    // Empty writes must not end the body early.
+    _, err = w.Write(nil)
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nDate: " + testDate + "\r\n\r\n5\r\nevent\r\n0\r\n\r\n", buf.String())
+}
+
+func Test_Auto_Framing_HTTP10_Large_Body_Closes(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.bufferSize = 4
+    w.SetProtocol("1.0", true)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    require.NoError(t, w.WriteHeaders(nil))
+    _, err := w.Write([]byte("hello"))
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.0 200 OK\r\nDate: " + testDate + "\r\n\r\nhello", buf.String())
+    assert.False(t, w.KeepAlive())
+}
+
+func Test_Write_Encodes_Declared_Chunked_Body(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Transfer-Encoding", "chunked")
+    require.NoError(t, w.WriteHeaders(h))
+    _, err := w.WriteBody([]byte("abc"))
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nDate: " + testDate + "\r\n\r\n3\r\nabc\r\n0\r\n\r\n", buf.String())
+}
+
+func Test_Auto_Framing_Skipped_Without_Body(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusNoContent))
+    require.NoError(t, w.WriteHeaders(nil))
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 204 No Content\r\nDate: " + testDate + "\r\n\r\n", buf.String())
+    assert.True(t, w.KeepAlive())
+}
+
+func Test_Response_Writer_Implicit_OK(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    rw := w.ResponseWriter()
+    assert.Same(t, rw, w.ResponseWriter())
+    rw.Header().Set("Content-Type", "application/json")
+    require.NoError(t, json.NewEncoder(rw).Encode(map[string]int{"n": 1}))
+    // Changes after the first write are not sent.
+    rw.Header().Set("X-Late", "1")
+    rw.WriteHeader(StatusNotFound)
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 8\r\nDate: " + testDate + "\r\n\r\n{\"n\":1}\n", buf.String())
+}
+
+func Test_Response_Writer_Explicit_Status(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    rw := w.ResponseWriter()
+    rw.WriteHeader(StatusNotFound)
+    _, err := io.Copy(rw, strings.NewReader("no such page\n"))
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 404 Not Found\r\nContent-Length: 13\r\nDate: " + testDate + "\r\n\r\nno such page\n", buf.String())
+}
+
+func Test_Response_Writer_Headers_Only(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.ResponseWriter().Header().Set("X-Request-Id", "42")
+    assert.False(t, w.WroteAnything())
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nX-Request-Id: 42\r\nContent-Length: 0\r\nDate: " + testDate + "\r\n\r\n", buf.String())
+}
+
+func Test_Response_Writer_Early_Hints(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    rw := w.ResponseWriter()
+    rw.Header().Add("Link", "</style.css>; rel=preload")
+    rw.WriteHeader(StatusEarlyHints)
+    _, err := rw.WriteString("ok")
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+
+    assert.Equal(t, "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+        "HTTP/1.1 200 OK\r\nLink: </style.css>; rel=preload\r\nContent-Length: 2\r\nDate: " + testDate + "\r\n\r\nok", buf.String())
+}
+
+func Test_Response_Writer_Invalid_Status(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    rw := w.ResponseWriter()
+    rw.WriteHeader(42)
+    _, err := rw.Write([]byte("x"))
+    assert.ErrorIs(t, err, ErrInvalidStatusCode)
+    assert.ErrorIs(t, w.Finish(), ErrInvalidStatusCode)
+    assert.Empty(t, buf.String())
+}
+
+func fixedLengthWriter(t *testing.T, buf *bytes.Buffer, length string) *Writer {
+    t.Helper()
+    w := NewWriter(buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", length)
+    require.NoError(t, w.WriteHeaders(h))
+    buf.Reset()
+    return w
+}
+
+func Test_Content_Length_Over_Write_Truncated(t *testing.T) {
+    var buf bytes.Buffer
+    w := fixedLengthWriter(t, &buf, "5")
+    n, err := w.Write([]byte("hel"))
+    require.NoError(t, err)
+    assert.Equal(t, 3, n)
+    n, err = w.Write([]byte("lo world"))
+    assert.ErrorIs(t, err, ErrBodyTooLong)
+    assert.Equal(t, 2, n)
+    _, err = w.Write([]byte("!"))
+    assert.ErrorIs(t, err, ErrBodyTooLong)
+
+    require.NoError(t, w.Finish())
+    assert.Equal(t, "hello", buf.String())
+    assert.True(t, w.KeepAlive())
+}
+
+func Test_Content_Length_Under_Write_Closes(t *testing.T) {
+    var buf bytes.Buffer
+    w := fixedLengthWriter(t, &buf, "10")
+    _, err := w.Write([]byte("short"))
+    require.NoError(t, err)
+
+    assert.ErrorIs(t, w.Finish(), ErrBodyTooShort)
+    assert.Equal(t, "short", buf.String())
+    assert.False(t, w.KeepAlive())
+}
+
+func Test_Chunked_Write_On_Fixed_Length_Rejected(t *testing.T) {
+    var buf bytes.Buffer
+    w := fixedLengthWriter(t, &buf, "3")
+    _, err := w.WriteChunkedBody([]byte("abc"))
+    assert.ErrorIs(t, err, ErrFramingMismatch)
+    _, err = w.WriteChunkedBodyDone()
+    assert.ErrorIs(t, err, ErrFramingMismatch)
+    assert.ErrorIs(t, w.WriteTrailers(headers.NewHeaders()), ErrFramingMismatch)
+    assert.Empty(t, buf.String())
+}
+
+func Test_Write_After_Chunked_Body_Done(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Transfer-Encoding", "chunked")
+    require.NoError(t, w.WriteHeaders(h))
+    _, err := w.WriteChunkedBodyDone()
+    require.NoError(t, err)
+    buf.Reset()
+
+    _, err = w.Write([]byte("late"))
+    assert.ErrorIs(t, err, ErrBodyDone)
+    _, err = w.WriteChunkedBody([]byte("late"))
+    assert.ErrorIs(t, err, ErrBodyDone)
+    require.NoError(t, w.Finish())
+    assert.Empty(t, buf.String())
+}
+
+func Test_Body_Not_Allowed(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusNotModified))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", "120")
+    require.NoError(t, w.WriteHeaders(h))
+    buf.Reset()
+
+    _, err := w.Write([]byte("body"))
+    assert.ErrorIs(t, err, ErrBodyNotAllowed)
+    require.NoError(t, w.Finish())
+    assert.Empty(t, buf.String())
+    assert.True(t, w.KeepAlive())
+}
+
+func Test_Invalid_Content_Length_Rejected(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", "-1")
+    assert.ErrorIs(t, w.WriteHeaders(h), ErrInvalidContentLength)
+}
+
+func Test_Head_Response_Discards_Body(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    w.SetMethod("HEAD")
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    require.NoError(t, w.WriteHeaders(nil))
+    n, err := w.Write([]byte("hello"))
+    require.NoError(t, err)
+    assert.Equal(t, 5, n)
+    require.NoError(t, w.Finish())
+    assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nDate: " + testDate + "\r\n\r\n", buf.String())
+
+    // A declared length need not be written.
+    buf.Reset()
+    w = NewWriter(&buf)
+    w.SetMethod("HEAD")
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    h := headers.NewHeaders()
+    h.Set("Content-Length", "100")
+    require.NoError(t, w.WriteHeaders(h))
+    require.NoError(t, w.Finish())
+    assert.True(t, w.KeepAlive())
+}
+
+func Test_Response_Writer_Invalid_Headers_Write_Nothing(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    rw := w.ResponseWriter()
+    rw.Header().Set("X-Bad", "a\r\nb")
+    _, err := rw.Write([]byte("x"))
+    assert.Error(t, err)
+    assert.Error(t, w.Finish())
+    assert.Empty(t, buf.String())
+    assert.False(t, w.WroteAnything())
+
+    // An error response can still be sent in its place.
+    require.NoError(t, w.WriteStatusLine(StatusInternalServerError))
+    assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n", buf.String())
+
+    // Invalid Content-Length values are caught before the status line too.
+    buf.Reset()
+    w = NewWriter(&buf)
+    w.ResponseWriter().Header().Set("Content-Length", "ten")
+    w.ResponseWriter().WriteHeader(StatusOK)
+    assert.ErrorIs(t, w.Finish(), ErrInvalidContentLength)
+    assert.Empty(t, buf.String())
+}
+
+func Test_Finish_After_Status_Line_Only(t *testing.T) {
+    var buf bytes.Buffer
+    w := NewWriter(&buf)
+    require.NoError(t, w.Finish())
+    require.NoError(t, w.WriteStatusLine(StatusOK))
+    assert.Error(t, w.Finish())
+    assert.False(t, w.KeepAlive())
+    assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+}
@@ -0,0 +1,110 @@
+package response
+
+import (
+    "fmt"
+    "io"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+)
+
+// ResponseWriter is an io.Writer for a response body that sends the
+// status line and headers implicitly, in the style of net/http. Headers
+// are set through Header() and sent by WriteHeader, or with a 200 status
+// by the first Write. The body is framed automatically unless the headers
+// declare a Content-Length or Transfer-Encoding.
+type ResponseWriter struct {
+    w      *Writer
+    header *headers.Headers
+    // wroteHeader is set once the final status line has been written.
+    wroteHeader bool
+    // err is the first error from writing the status line or headers.
+    err error
+}
+
+var (
+    _ io.Writer       = (*ResponseWriter)(nil)
+    _ io.StringWriter = (*ResponseWriter)(nil)
+)
+
+// ResponseWriter returns the io.Writer view of wr. Every call returns the
+// same ResponseWriter, so headers set through one are seen by all. It
+// must not be mixed with WriteStatusLine and WriteHeaders.
+func (wr *Writer) ResponseWriter() *ResponseWriter {
+    if wr.rw == nil {
+        wr.rw = &ResponseWriter{w: wr, header: headers.NewHeaders()}
+    }
+    return wr.rw
+}
+
+// Header returns the headers to send with the response. Changes made
+// after WriteHeader or the first Write have no effect, except for
+// informational responses, which send the headers set so far and keep
+// them for the final response.
+func (rw *ResponseWriter) Header() *headers.Headers {
+    return rw.header
+}
+
+// WriteHeader sends the status line and headers with status code. A 1xx
+// code other than 101 sends an interim response; any later call is
+// ignored once the final status is written. An invalid code, or headers
+// that cannot be written, make later writes fail. In that case nothing is
+// written, so the server can still answer with an error.
+func (rw *ResponseWriter) WriteHeader(code StatusCode) {
+    if rw.wroteHeader || rw.err != nil {
+        return
+    }
+    if err := checkHeaders(rw.header); err != nil {
+        rw.err = err
+        return
+    }
+    if code >= 100 && code <= 199 && code != StatusSwitchingProtocols {
+        rw.err = rw.w.WriteInterim(code, rw.header)
+        return
+    }
+    rw.wroteHeader = true
+    if err := rw.w.WriteStatusLine(code); err != nil {
+        rw.err = err
+        return
+    }
+    rw.err = rw.w.WriteHeaders(rw.header)
+}
+
+// Write writes p to the body, first sending a 200 status if WriteHeader
+// has not been called.
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+    if !rw.wroteHeader {
+        rw.WriteHeader(StatusOK)
+    }
+    if rw.err != nil {
+        return 0, rw.err
+    }
+    return rw.w.Write(p)
+}
+
+// WriteString is like Write but takes a string.
+func (rw *ResponseWriter) WriteString(s string) (int, error) {
+    return rw.Write([]byte(s))
+}
+
+// Flush sends the headers and any buffered body to the client, switching
+// an automatically framed body to chunked coding.
+func (rw *ResponseWriter) Flush() error {
+    if !rw.wroteHeader {
+        rw.WriteHeader(StatusOK)
+    }
+    if rw.err != nil {
+        return rw.err
+    }
+    return rw.w.Flush()
+}
+
+// finish sends a 200 status with the headers if nothing has been written.
+func (rw *ResponseWriter) finish() error {
+    if !rw.wroteHeader {
+        rw.WriteHeader(StatusOK)
+    }
+    if rw.err != nil {
+        return fmt.Errorf("response headers: %w", rw.err)
+    }
+    return nil
+}
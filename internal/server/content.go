@@ -0,0 +1,183 @@
+package server
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/xaitan80/httpfromtcp/internal/headers"
+    "github.com/xaitan80/httpfromtcp/internal/request"
+    "github.com/xaitan80/httpfromtcp/internal/response"
+)
+
+// Content describes a representation served by ServeContent.
+type Content struct {
+    // Type is the Content-Type of the representation.
+    Type string
+    // ModTime is sent as Last-Modified unless zero.
+    ModTime time.Time
+    // ETag is a quoted entity tag, such as `"v1"`, sent unless empty.
+    ETag string
+    // Body is read from as needed; it is never loaded whole.
+    Body io.ReadSeeker
+}
+
+// ServeContent answers r with c, honouring byte-range requests. A Range
+// field is answered with 206 Partial Content: a single range with a
+// Content-Range field, several as a multipart/byteranges body. A range
+// past the end is answered with 416 Range Not Satisfiable. Range is
+// ignored for methods other than GET, when malformed, or when an If-Range
+// field no longer matches c. It returns an error if nothing could be
+// written; a failure while copying the body leaves the response short,
+// which closes the connection.
+func ServeContent(w *response.Writer, r *request.Request, c Content) error {
+    size, err := c.Body.Seek(0, io.SeekEnd)
+    if err != nil {
+        return err
+    }
+    h := headers.NewHeaders()
+    h.Set("Accept-Ranges", "bytes")
+    if !c.ModTime.IsZero() {
+        h.Set("Last-Modified", headers.FormatTime(c.ModTime))
+    }
+    if c.ETag != "" {
+        h.Set("ETag", c.ETag)
+    }
+    if c.Type != "" {
+        h.Set("Content-Type", c.Type)
+    }
+
+    var ranges []headers.ByteRange
+    if r.RequestLine.Method == "GET" && r.Headers.Has("Range") && ifRangeMatches(r.Headers, c) {
+        ranges, err = headers.ParseRange(r.Headers.Get("Range"), size)
+        if errors.Is(err, headers.ErrUnsatisfiableRange) {
+            h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+            h.Set("Content-Length", "0")
+            if err := w.WriteStatusLine(response.StatusRangeNotSatisfiable); err != nil {
+                return err
+            }
+            return w.WriteHeaders(h)
+        }
+    }
+    bodyless := r.RequestLine.Method == "HEAD"
+
+    switch len(ranges) {
+    case 0:
+        h.Set("Content-Length", strconv.FormatInt(size, 10))
+        if err := w.WriteStatusLine(response.StatusOK); err != nil {
+            return err
+        }
+        if err := w.WriteHeaders(h); err != nil {
+            return err
+        }
+        if bodyless {
+            return nil
+        }
+        return copyRange(w, c.Body, headers.ByteRange{Start: 0, Length: size})
+    case 1:
+        h.Set("Content-Range", ranges[0].ContentRange(size))
+        h.Set("Content-Length", strconv.FormatInt(ranges[0].Length, 10))
+        if err := w.WriteStatusLine(response.StatusPartialContent); err != nil {
+            return err
+        }
+        if err := w.WriteHeaders(h); err != nil {
+            return err
+        }
+        if bodyless {
+            return nil
+        }
+        return copyRange(w, c.Body, ranges[0])
+    default:
+        return serveMultipartRanges(w, h, c, ranges, size, bodyless)
+    }
+}
+
+// serveMultipartRanges writes a 206 response with a multipart/byteranges
+// body holding each range. The body length is computed up front so the
+// response carries a Content-Length.
+func serveMultipartRanges(w *response.Writer, h *headers.Headers, c Content, ranges []headers.ByteRange, size int64, bodyless bool) error {
+    boundary, err := newBoundary()
+    if err != nil {
+        return err
+    }
+    partHeads := make([]string, len(ranges))
+    length := int64(0)
+    for i, br := range ranges {
+        var b strings.Builder
+        if i > 0 {
+            b.WriteString("\r\n")
+        }
+        b.WriteString("--" + boundary + "\r\n")
+        if c.Type != "" {
+            b.WriteString("Content-Type: " + c.Type + "\r\n")
+        }
+        b.WriteString("Content-Range: " + br.ContentRange(size) + "\r\n\r\n")
+        partHeads[i] = b.String()
+        length += int64(len(partHeads[i])) + br.Length
+    }
+    closing := "\r\n--" + boundary + "--\r\n"
+    length += int64(len(closing))
+
+    h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+    h.Set("Content-Length", strconv.FormatInt(length, 10))
+    if err := w.WriteStatusLine(response.StatusPartialContent); err != nil {
+        return err
+    }
+    if err := w.WriteHeaders(h); err != nil {
+        return err
+    }
+    if bodyless {
+        return nil
+    }
+    for i, br := range ranges {
+        if _, err := io.WriteString(w, partHeads[i]); err != nil {
+            return err
+        }
+        if err := copyRange(w, c.Body, br); err != nil {
+            return err
+        }
+    }
+    _, err = io.WriteString(w, closing)
+    return err
+}
+
+// copyRange copies br from body to w.
+func copyRange(w io.Writer, body io.ReadSeeker, br headers.ByteRange) error {
+    if _, err := body.Seek(br.Start, io.SeekStart); err != nil {
+        return err
+    }
+    _, err := io.CopyN(w, body, br.Length)
+    return err
+}
+
+// ifRangeMatches reports whether the If-Range field, if any, still
+// matches c. An entity tag must match c.ETag strongly; a date must equal
+// c.ModTime to the second.
+func ifRangeMatches(h *headers.Headers, c Content) bool {
+    if !h.Has("If-Range") {
+        return true
+    }
+    v := strings.TrimSpace(h.Get("If-Range"))
+    if strings.HasPrefix(v, `"`) {
+        return c.ETag != "" && !strings.HasPrefix(c.ETag, "W/") && v == c.ETag
+    }
+    if strings.HasPrefix(v, "W/") {
+        return false
+    }
+    t, ok := h.Time("If-Range")
+    return ok && !c.ModTime.IsZero() && t.Equal(c.ModTime.Truncate(time.Second))
+}
+
+// newBoundary returns a random multipart boundary.
+func newBoundary() (string, error) {
+    var b [16]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b[:]), nil
+}
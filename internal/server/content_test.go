@@ -0,0 +1,115 @@
+package server
+
+import (
+    "bytes"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    "github.com/xaitan80/httpfromtcp/internal/request"
+    "github.com/xaitan80/httpfromtcp/internal/response"
+)
+
+var testModTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// serveTestContent answers the request head in raw with the 26 letters
+// of the alphabet and returns the response head and body.
+func serveTestContent(t *testing.T, raw string) (string, string) {
+    t.Helper()
+    r, err := request.RequestFromReader(strings.NewReader(raw))
+    require.NoError(t, err)
+    var buf bytes.Buffer
+    w := response.NewWriter(&buf)
+    w.SetMethod(r.RequestLine.Method)
+    err = ServeContent(w, r, Content{
+        Type:    "text/plain",
+        ModTime: testModTime,
+        ETag:    `"abc"`,
+        Body:    strings.NewReader("abcdefghijklmnopqrstuvwxyz"),
+    })
+    require.NoError(t, err)
+    require.NoError(t, w.Finish())
+    head, body, _ := strings.Cut(buf.String(), "\r\n\r\n")
+    return head, body
+}
+
+func Test_Serve_Content_Full(t *testing.T) {
+    head, body := serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+    assert.Contains(t, head, "Accept-Ranges: bytes\r\n")
+    assert.Contains(t, head, "Last-Modified: Wed, 01 May 2024 12:00:00 GMT\r\n")
+    assert.Contains(t, head, "ETag: \"abc\"\r\n")
+    assert.Contains(t, head, "Content-Length: 26\r\n")
+    assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", body)
+
+    head, body = serveTestContent(t, "HEAD /f HTTP/1.1\r\nHost: x\r\nRange: bytes=0-1\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+    assert.Contains(t, head, "Content-Length: 26\r\n")
+    assert.Empty(t, body)
+}
+
+func Test_Serve_Content_Single_Range(t *testing.T) {
+    head, body := serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\nRange: bytes=-3\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 206 Partial Content\r\n")
+    assert.Contains(t, head, "Content-Range: bytes 23-25/26\r\n")
+    assert.Contains(t, head, "Content-Length: 3\r\n")
+    assert.Contains(t, head, "Content-Type: text/plain\r\n")
+    assert.Equal(t, "xyz", body)
+}
+
+func Test_Serve_Content_Multiple_Ranges(t *testing.T) {
+    head, body := serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\nRange: bytes=0-2, 10-\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 206 Partial Content\r\n")
+    _, boundary, ok := strings.Cut(head, "Content-Type: multipart/byteranges; boundary=")
+    require.True(t, ok)
+    boundary, _, _ = strings.Cut(boundary, "\r\n")
+
+    want := "--" + boundary + "\r\nContent-Type: text/plain\r\nContent-Range: bytes 0-2/26\r\n\r\nabc\r\n" +
+        "--" + boundary + "\r\nContent-Type: text/plain\r\nContent-Range: bytes 10-25/26\r\n\r\nklmnopqrstuvwxyz\r\n" +
+        "--" + boundary + "--\r\n"
+    assert.Equal(t, want, body)
+    assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(want))+"\r\n")
+}
+
+func Test_Serve_Content_Unsatisfiable(t *testing.T) {
+    head, body := serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\nRange: bytes=26-\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 416 Range Not Satisfiable\r\n")
+    assert.Contains(t, head, "Content-Range: bytes */26\r\n")
+    assert.Empty(t, body)
+
+    // Overlapping ranges that add up to more than the content are ignored.
+    head, body = serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\nRange: bytes=0-,0-,0-,0-\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+    assert.Len(t, body, 26)
+
+    // A malformed Range is ignored.
+    head, body = serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\nRange: bytes=z-\r\n\r\n")
+    assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+    assert.Len(t, body, 26)
+}
+
+func Test_Serve_Content_If_Range(t *testing.T) {
+    for _, tt := range []struct {
+        ifRange string
+        partial bool
+    }{
+        {`"abc"`, true},
+        {`"old"`, false},
+        {`W/"abc"`, false},
+        {"Wed, 01 May 2024 12:00:00 GMT", true},
+        {"Tue, 30 Apr 2024 12:00:00 GMT", false},
+    } {
+        head, body := serveTestContent(t, "GET /f HTTP/1.1\r\nHost: x\r\nRange: bytes=0-0\r\nIf-Range: "+tt.ifRange+"\r\n\r\n")
+        if tt.partial {
+            assert.Contains(t, head, "HTTP/1.1 206 Partial Content\r\n", tt.ifRange)
+            assert.Equal(t, "a", body, tt.ifRange)
+        } else {
+            assert.Contains(t, head, "HTTP/1.1 200 OK\r\n", tt.ifRange)
+            assert.Len(t, body, 26, tt.ifRange)
+        }
+    }
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+    "errors"
     "fmt"
+    "io"
+    "log"
     "net"
     "sync/atomic"
 
@@ -14,16 +17,22 @@ type Server struct {
     ln     net.Listener
     closed atomic.Bool
     h      Handler
+    limits request.Limits
 }
 
 // Serve starts a TCP listener on the given port and begins accepting
 // connections in a background goroutine.
 func Serve(port int, h Handler) (*Server, error) {
+    return ServeWithLimits(port, h, request.DefaultLimits)
+}
+
+// ServeWithLimits is like Serve but parses requests with the given limits.
+func ServeWithLimits(port int, h Handler, limits request.Limits) (*Server, error) {
     ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
     if err != nil {
         return nil, err
     }
-    s := &Server{ln: ln, h: h}
+    s := &Server{ln: ln, h: h, limits: limits}
     go s.listen()
     return s, nil
 }
@@ -55,30 +64,132 @@ func (s *Server) listen() {
     }
 }
 
-// handle writes a fixed HTTP response and closes the connection.
+// handle serves requests from conn until the client or the response asks
+// for the connection to be closed, then closes it.
 func (s *Server) handle(conn net.Conn) {
     defer conn.Close()
-    r, err := request.RequestFromReader(conn)
-    if err != nil {
-        // On parse error, return 400 with plain text error via response.Writer
-        rw := response.NewWriter(conn)
-        _ = rw.WriteStatusLine(response.StatusBadRequest)
-        hdrs := response.GetDefaultHeaders(len(err.Error()) + 1)
-        _ = rw.WriteHeaders(hdrs)
-        _, _ = rw.WriteBody([]byte(err.Error() + "\n"))
-        return
+    cr := request.NewReaderWithLimits(conn, s.limits)
+    for {
+        r, err := cr.ReadRequest()
+        if err == io.EOF {
+            // Client closed the connection without sending another request.
+            return
+        }
+        if errors.Is(err, request.ErrUnreadBody) {
+            // The previous request was already answered; a second response
+            // to it would desynchronize the client.
+            return
+        }
+        if err != nil {
+            var pe *request.ParseError
+            if errors.As(err, &pe) {
+                log.Printf("parse error: remote=%s category=%s offset=%d status=%d err=%q",
+                    conn.RemoteAddr(), pe.Category, pe.Offset, pe.StatusCode, pe.Err)
+            }
+            // On parse error, return a plain text error via response.Writer.
+            // The rest of the stream cannot be trusted, so close afterwards.
+            rw := response.NewWriter(conn)
+            rw.SetProtocol(parseErrorVersion(err), false)
+            _ = rw.WriteStatusLine(parseErrorStatus(err))
+            hdrs := response.GetDefaultHeaders(len(err.Error()) + 1)
+            _ = rw.WriteHeaders(hdrs)
+            _, _ = rw.WriteBody([]byte(err.Error() + "\n"))
+            return
+        }
+        if !s.serve(r, conn) {
+            return
+        }
     }
+}
 
+// serve runs the handler for a single request and reports whether the
+// connection can be reused for another request.
+func (s *Server) serve(r *request.Request, conn net.Conn) bool {
     rw := response.NewWriter(conn)
+    rw.SetProtocol(r.RequestLine.HttpVersion, r.KeepAlive())
+    rw.SetMethod(r.RequestLine.Method)
+
+    // Answer "Expect: 100-continue" once the handler starts reading the
+    // body. A handler may instead reject the request without reading it.
+    waitingForBody := false
+    if expect := r.Headers.Get("Expect"); expect != "" && r.ProtoAtLeast(1, 1) {
+        if !r.ExpectsContinue() {
+            // The body may or may not follow; it cannot be skipped reliably.
+            rw.SetProtocol(r.RequestLine.HttpVersion, false)
+            _ = writeHandlerError(rw, &HandlerError{
+                Status: response.StatusExpectationFailed,
+                Body:   []byte("unsupported expectation\n"),
+            })
+            return false
+        }
+        waitingForBody = r.HasBody()
+        if waitingForBody {
+            // Until the handler reads the body, a response must announce
+            // that the connection will be closed.
+            rw.SetProtocol(r.RequestLine.HttpVersion, false)
+        }
+        r.OnBodyRead(func() error {
+            waitingForBody = false
+            if rw.WroteAnything() {
+                // The final response has begun; the client needs no permission.
+                return nil
+            }
+            rw.SetProtocol(r.RequestLine.HttpVersion, r.KeepAlive())
+            return rw.WriteInterim(response.StatusContinue, nil)
+        })
+    }
+    if !s.run(r, rw) {
+        return false
+    }
+    // The client may or may not send a body it was never asked for, so the
+    // connection cannot be reused reliably.
+    return !waitingForBody && rw.KeepAlive()
+}
+
+// run calls the handler and writes a default response if it wrote none.
+// It reports whether the response was written completely.
+func (s *Server) run(r *request.Request, rw *response.Writer) bool {
     if s.h != nil {
-        if herr := s.h(r, rw); herr != nil {
+        herr := s.h(r, rw)
+        if pe := bodyParseError(r); pe != nil {
+            // The body was rejected while the handler read it, for example
+            // for exceeding the size limit. Answer with the error it calls
+            // for; the rest of the body cannot be skipped reliably.
+            if rw.WroteAnything() {
+                _ = rw.Finish()
+                return false
+            }
+            rw.SetProtocol(r.RequestLine.HttpVersion, false)
+            _ = writeHandlerError(rw, &HandlerError{
+                Status: response.StatusCode(pe.StatusCode),
+                Body:   []byte(pe.Error() + "\n"),
+            })
+            return false
+        }
+        if herr != nil {
             // If handler returned an error and hasn't written anything, default error output
             if !rw.WroteAnything() {
-                _ = writeHandlerError(rw, herr)
+                return writeHandlerError(rw, herr) == nil && rw.KeepAlive()
             }
-            return
+            // A partially written response cannot be followed by another one.
+            return false
         }
     }
+    // Send a buffered body, end a chunked one the handler left open, or
+    // send the headers a handler set through ResponseWriter. A body
+    // shorter than its Content-Length leaves the connection unusable.
+    if err := rw.Finish(); err != nil {
+        log.Printf("incomplete response: %v", err)
+        if !rw.WroteAnything() {
+            // The handler's headers were rejected before anything was sent.
+            rw.SetProtocol(r.RequestLine.HttpVersion, false)
+            _ = writeHandlerError(rw, &HandlerError{
+                Status: response.StatusInternalServerError,
+                Body:   []byte("internal server error\n"),
+            })
+        }
+        return false
+    }
     // If handler didn't write anything, write default empty 200
     if !rw.WroteAnything() {
         _ = rw.WriteStatusLine(response.StatusOK)
@@ -86,6 +197,36 @@ func (s *Server) handle(conn net.Conn) {
         _ = rw.WriteHeaders(hdrs)
         // no body
     }
+    return true
+}
+
+// bodyParseError returns the parse error that stopped reading the body of
+// r, if any.
+func bodyParseError(r *request.Request) *request.ParseError {
+    var pe *request.ParseError
+    if errors.As(r.BodyError(), &pe) {
+        return pe
+    }
+    return nil
+}
+
+// parseErrorStatus maps a request parse error to the response status code.
+func parseErrorStatus(err error) response.StatusCode {
+    var pe *request.ParseError
+    if errors.As(err, &pe) {
+        return response.StatusCode(pe.StatusCode)
+    }
+    return response.StatusBadRequest
+}
+
+// parseErrorVersion returns the HTTP version to answer a request parse
+// error with: that of the request-line if it was parsed, else HTTP/1.1.
+func parseErrorVersion(err error) string {
+    var pe *request.ParseError
+    if errors.As(err, &pe) && pe.Version != "" {
+        return pe.Version
+    }
+    return "1.1"
 }
 
 // Handler is the function signature used to handle requests.
@@ -94,7 +235,7 @@ type Handler func(r *request.Request, w *response.Writer) *HandlerError
 // HandlerError represents an error returned from a Handler.
 type HandlerError struct {
     Status  response.StatusCode
-    Headers headers.Headers
+    Headers *headers.Headers
     Body    []byte
 }
 
@@ -113,10 +254,7 @@ func writeHandlerError(w *response.Writer, he *HandlerError) error {
         hdrs = response.GetDefaultHeaders(len(body))
     } else {
         hdrs.Set("Content-Length", fmt.Sprintf("%d", len(body)))
-        if _, ok := hdrs["Connection"]; !ok {
-            hdrs.Set("Connection", "close")
-        }
-        if _, ok := hdrs["Content-Type"]; !ok {
+        if !hdrs.Has("Content-Type") {
             hdrs.Set("Content-Type", "text/plain")
         }
     }
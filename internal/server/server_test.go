@@ -0,0 +1,222 @@
+package server
+
+import (
+    "io"
+    "net"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    "github.com/xaitan80/httpfromtcp/internal/request"
+    "github.com/xaitan80/httpfromtcp/internal/response"
+)
+
+// startTestServer serves h on a free local port with limits.
+func startTestServer(t *testing.T, h Handler, limits request.Limits) string {
+    t.Helper()
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    require.NoError(t, err)
+    s := &Server{ln: ln, h: h, limits: limits}
+    go s.listen()
+    t.Cleanup(func() { _ = s.Close() })
+    return ln.Addr().String()
+}
+
+// roundTrip sends raw on a new connection and returns everything the
+// server writes until it closes the connection.
+func roundTrip(t *testing.T, addr, raw string) string {
+    t.Helper()
+    conn, err := net.Dial("tcp", addr)
+    require.NoError(t, err)
+    defer conn.Close()
+    require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+    _, err = io.WriteString(conn, raw)
+    require.NoError(t, err)
+    out, err := io.ReadAll(conn)
+    require.NoError(t, err, "server did not close the connection")
+    return string(out)
+}
+
+const oversizedChunkedRequest = "POST /upload HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n" +
+    "14\r\n01234567890123456789\r\n0\r\n\r\n"
+
+func Test_Chunked_Body_Limit_Unread_Body_Closes_Silently(t *testing.T) {
+    limits := request.DefaultLimits
+    limits.MaxBodyBytes = 10
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        _, _ = w.ResponseWriter().Write([]byte("hi"))
+        return nil
+    }, limits)
+
+    out := roundTrip(t, addr, oversizedChunkedRequest)
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+    assert.True(t, strings.HasSuffix(out, "\r\n\r\nhi"), out)
+    assert.Equal(t, 1, strings.Count(out, "HTTP/1.1 "), out)
+}
+
+func Test_Chunked_Body_Limit_Read_Body_Answers_413(t *testing.T) {
+    limits := request.DefaultLimits
+    limits.MaxBodyBytes = 10
+    var readErr error
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        _, readErr = io.ReadAll(r.BodyReader)
+        return nil
+    }, limits)
+
+    out := roundTrip(t, addr, oversizedChunkedRequest)
+    assert.ErrorIs(t, readErr, request.ErrBodyTooLarge)
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\n"), out)
+    assert.Equal(t, 1, strings.Count(out, "HTTP/1.1 "), out)
+}
+
+func Test_Invalid_Handler_Headers_Answer_500(t *testing.T) {
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        rw := w.ResponseWriter()
+        rw.Header().Set("X-Bad", "a\r\nb")
+        _, _ = rw.Write([]byte("hello"))
+        return nil
+    }, request.DefaultLimits)
+
+    out := roundTrip(t, addr, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"), out)
+    assert.NotContains(t, out, "X-Bad")
+    assert.NotContains(t, out, "hello")
+}
+
+func Test_Default_And_Error_Responses_Keep_Connection_Alive(t *testing.T) {
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        if r.RequestLine.RequestTarget == "/missing" {
+            return &HandlerError{Status: response.StatusNotFound, Body: []byte("not found\n")}
+        }
+        return nil
+    }, request.DefaultLimits)
+
+    out := roundTrip(t, addr, "GET / HTTP/1.1\r\nHost: x\r\n\r\n"+
+        "GET /missing HTTP/1.1\r\nHost: x\r\n\r\n"+
+        "GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+    assert.Equal(t, 2, strings.Count(out, "HTTP/1.1 200 OK\r\n"), out)
+    assert.Equal(t, 1, strings.Count(out, "HTTP/1.1 404 Not Found\r\n"), out)
+    assert.Equal(t, 1, strings.Count(out, "Connection: close\r\n"), out)
+}
+
+func Test_Parse_Error_Answers_With_Request_Version(t *testing.T) {
+    addr := startTestServer(t, nil, request.DefaultLimits)
+
+    out := roundTrip(t, addr, "GET / HTTP/1.0\r\nBad Header: x\r\n\r\n")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.0 400 Bad Request\r\n"), out)
+    assert.NotContains(t, out, "keep-alive")
+
+    out = roundTrip(t, addr, "GET / HTTP/1.1\r\nBad Header: x\r\n\r\n")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"), out)
+    assert.Contains(t, out, "Connection: close\r\n")
+}
+
+func Test_Smuggling_Pipelined_Request_Not_Reached(t *testing.T) {
+    // A server honoring Content-Length would read the "0\r\n\r\n" chunk
+    // terminator as the body and the smuggled GET as a second request.
+    var targets []string
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        targets = append(targets, r.RequestLine.RequestTarget)
+        _, _ = io.ReadAll(r.BodyReader)
+        return nil
+    }, request.DefaultLimits)
+
+    out := roundTrip(t, addr, "POST / HTTP/1.1\r\n"+
+        "Host: x\r\n"+
+        "Content-Length: 4\r\n"+
+        "Transfer-Encoding: chunked\r\n"+
+        "\r\n"+
+        "0\r\n\r\n"+
+        "GET /admin HTTP/1.1\r\nHost: x\r\n\r\n")
+    assert.Equal(t, []string{"/"}, targets)
+    assert.Equal(t, 1, strings.Count(out, "HTTP/1.1 "), out)
+    assert.Contains(t, out, "Connection: close\r\n")
+}
+
+// expectHandler reads the body in small pieces unless the target is
+// /reject, and answers with what it read.
+func expectHandler(r *request.Request, w *response.Writer) *HandlerError {
+    if r.RequestLine.RequestTarget == "/reject" {
+        return &HandlerError{Status: response.StatusForbidden, Body: []byte("no\n")}
+    }
+    var body []byte
+    buf := make([]byte, 2)
+    for {
+        n, err := r.BodyReader.Read(buf)
+        body = append(body, buf[:n]...)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return &HandlerError{Status: response.StatusBadRequest, Body: []byte(err.Error())}
+        }
+    }
+    _, _ = w.ResponseWriter().Write(body)
+    return nil
+}
+
+func Test_Expect_Continue_Sent_Once_On_First_Body_Read(t *testing.T) {
+    addr := startTestServer(t, expectHandler, request.DefaultLimits)
+
+    out := roundTrip(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\n"+
+        "Content-Length: 4\r\nConnection: close\r\n\r\ndata")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n"), out)
+    assert.Equal(t, 1, strings.Count(out, "100 Continue"), out)
+    assert.True(t, strings.HasSuffix(out, "\r\n\r\ndata"), out)
+}
+
+func Test_Expect_Continue_Not_Sent_After_Final_Response(t *testing.T) {
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        rw := w.ResponseWriter()
+        rw.Header().Set("Content-Length", "2")
+        rw.WriteHeader(response.StatusOK)
+        _, _ = io.ReadAll(r.BodyReader)
+        _, _ = rw.Write([]byte("ok"))
+        return nil
+    }, request.DefaultLimits)
+
+    out := roundTrip(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\n"+
+        "Content-Length: 4\r\nConnection: close\r\n\r\ndata")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+    assert.NotContains(t, out, "100 Continue")
+    assert.True(t, strings.HasSuffix(out, "\r\n\r\nok"), out)
+}
+
+func Test_Expect_Unknown_Answers_417_And_Closes(t *testing.T) {
+    called := false
+    addr := startTestServer(t, func(r *request.Request, w *response.Writer) *HandlerError {
+        called = true
+        return nil
+    }, request.DefaultLimits)
+
+    // Without Connection: close, roundTrip only returns if the server closes.
+    out := roundTrip(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 200-ok\r\nContent-Length: 4\r\n\r\n")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 417 Expectation Failed\r\n"), out)
+    assert.Contains(t, out, "Connection: close\r\n")
+    assert.False(t, called)
+}
+
+func Test_Expect_Continue_Rejected_Without_Reading_Closes(t *testing.T) {
+    addr := startTestServer(t, expectHandler, request.DefaultLimits)
+
+    // The client holds back the body, so the server cannot skip it and
+    // must close the connection after answering.
+    out := roundTrip(t, addr, "POST /reject HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\n")
+    assert.True(t, strings.HasPrefix(out, "HTTP/1.1 403 Forbidden\r\n"), out)
+    assert.NotContains(t, out, "100 Continue")
+    assert.Contains(t, out, "Connection: close\r\n")
+}
+
+func Test_Expect_Ignored_For_HTTP_1_0(t *testing.T) {
+    addr := startTestServer(t, expectHandler, request.DefaultLimits)
+
+    for _, expect := range []string{"100-continue", "200-ok"} {
+        out := roundTrip(t, addr, "POST / HTTP/1.0\r\nExpect: "+expect+"\r\nContent-Length: 4\r\n\r\ndata")
+        assert.True(t, strings.HasPrefix(out, "HTTP/1.0 200 OK\r\n"), out)
+        assert.NotContains(t, out, "100 Continue")
+        assert.True(t, strings.HasSuffix(out, "\r\n\r\ndata"), out)
+    }
+}